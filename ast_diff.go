@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// signatureCache remembers the declarations of the Go files without the function
+// bodies, to know if a change only edited the code inside the functions.
+type signatureCache struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+func newSignatureCache() *signatureCache {
+	return &signatureCache{hashes: make(map[string]string)}
+}
+
+// Changed reports if the imports, types or signatures of the file changed since
+// the last time. Files seen for the first time, removed or that cannot be parsed
+// are always reported as changed.
+func (cache *signatureCache) Changed(path string) bool {
+	hash, ok := signatureHash(path)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if !ok {
+		delete(cache.hashes, path)
+		return true
+	}
+	prev, seen := cache.hashes[path]
+	cache.hashes[path] = hash
+	return !seen || prev != hash
+}
+
+// Load hashes the Go files of the watched folders in the background, so the first
+// change of every file is compared too. The files of globs are hashed when they
+// change for the first time.
+func (cache *signatureCache) Load(ctx context.Context, opts watchOptions, folders []string) func() error {
+	return func() error {
+		for _, folder := range folders {
+			if isGlob(folder) {
+				continue
+			}
+			dirs, err := walkFolders(opts, folder, nil)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"path":  folder,
+					"error": err.Error(),
+				}).Debug("Cannot hash the signatures of the folder")
+				continue
+			}
+			for _, dir := range dirs {
+				if ctx.Err() != nil {
+					return nil
+				}
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					continue
+				}
+				for _, entry := range entries {
+					if entry.IsDir() || filepath.Ext(entry.Name()) != ".go" {
+						continue
+					}
+					path := filepath.Join(dir, entry.Name())
+					hash, ok := signatureHash(path)
+					if !ok {
+						continue
+					}
+					// A change detected meanwhile has a newer hash.
+					cache.mu.Lock()
+					if _, seen := cache.hashes[path]; !seen {
+						cache.hashes[path] = hash
+					}
+					cache.mu.Unlock()
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func signatureHash(path string) (string, bool) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return "", false
+	}
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			fn.Body = nil
+		}
+	}
+
+	h := sha256.New()
+	if err := printer.Fprint(h, fset, f); err != nil {
+		return "", false
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
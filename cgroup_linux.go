@@ -0,0 +1,105 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroup is a v2 control group created under the one of reloader to limit the
+// resources of the app.
+type cgroup struct {
+	path string
+}
+
+func newCgroup(limits resourceLimits) (*cgroup, error) {
+	content, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var parent string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			parent = filepath.Join(cgroupRoot, strings.TrimPrefix(line, "0::"))
+			break
+		}
+	}
+	if _, err := os.Stat(filepath.Join(parent, "cgroup.controllers")); parent == "" || err != nil {
+		return nil, errors.Errorf("cgroups v2 not available")
+	}
+
+	// Enable the controllers for the children. It may already be enabled or fail
+	// because of the permissions; writing the limits will report it anyway.
+	_ = os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+cpu +memory"), 0644)
+
+	cg := &cgroup{path: filepath.Join(parent, fmt.Sprintf("reloader-%d", os.Getpid()))}
+	if err := os.Mkdir(cg.path, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if limits.cpu > 0 {
+		value := fmt.Sprintf("%d 100000", int64(limits.cpu*100000))
+		if err := os.WriteFile(filepath.Join(cg.path, "cpu.max"), []byte(value), 0644); err != nil {
+			cg.Remove()
+			return nil, errors.Trace(err)
+		}
+	}
+	if limits.memory > 0 {
+		value := strconv.FormatInt(limits.memory, 10)
+		if err := os.WriteFile(filepath.Join(cg.path, "memory.max"), []byte(value), 0644); err != nil {
+			cg.Remove()
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return cg, nil
+}
+
+// Configure starts the process directly inside the control group, so the children
+// it forks right after starting cannot escape the limits. The returned function
+// closes the group after starting the process. It is a no-op if the limits are
+// disabled.
+func (cg *cgroup) Configure(cmd *exec.Cmd) func() {
+	if cg == nil {
+		return func() {}
+	}
+	dir, err := os.Open(cg.path)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  cg.path,
+			"error": err.Error(),
+		}).Warning("Cannot limit the resources of the app, it will run unconstrained")
+		return func() {}
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return func() {
+		dir.Close()
+	}
+}
+
+// Remove deletes the control group. It is a no-op if the limits are disabled.
+func (cg *cgroup) Remove() {
+	if cg == nil {
+		return
+	}
+	if err := os.Remove(cg.path); err != nil {
+		log.WithFields(log.Fields{
+			"path":  cg.path,
+			"error": err.Error(),
+		}).Debug("Cannot remove the cgroup")
+	}
+}
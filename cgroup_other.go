@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"os/exec"
+
+	"github.com/altipla-consulting/errors"
+)
+
+// cgroup is only available in Linux.
+type cgroup struct{}
+
+func newCgroup(limits resourceLimits) (*cgroup, error) {
+	return nil, errors.Errorf("cgroups are only available in Linux")
+}
+
+func (cg *cgroup) Configure(cmd *exec.Cmd) func() {
+	return func() {}
+}
+
+func (cg *cgroup) Remove() {}
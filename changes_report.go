@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// changesReport tallies the change events by extension and folder to find noisy
+// folders worth ignoring.
+type changesReport struct {
+	exts map[string]int
+	dirs map[string]int
+}
+
+func newChangesReport() *changesReport {
+	return &changesReport{
+		exts: make(map[string]int),
+		dirs: make(map[string]int),
+	}
+}
+
+// Add counts a new change. It is a no-op if the report is disabled.
+func (report *changesReport) Add(change string) {
+	if report == nil {
+		return
+	}
+	ext := filepath.Ext(change)
+	if ext == "" {
+		ext = "(none)"
+	}
+	report.exts[ext]++
+	report.dirs[filepath.Dir(change)]++
+}
+
+// Print logs the counters sorted from the noisiest to the quietest. It is a no-op if
+// the report is disabled.
+func (report *changesReport) Print() {
+	if report == nil {
+		return
+	}
+	log.Info(status("change events by extension:"))
+	printCounters(report.exts, "ext")
+	log.Info(status("change events by folder:"))
+	printCounters(report.dirs, "folder")
+}
+
+func printCounters(counters map[string]int, field string) {
+	keys := maps.Keys(counters)
+	slices.SortFunc(keys, func(a, b string) bool {
+		if counters[a] != counters[b] {
+			return counters[a] > counters[b]
+		}
+		return a < b
+	})
+	for _, key := range keys {
+		log.WithFields(log.Fields{
+			field:    key,
+			"events": counters[key],
+		}).Info()
+	}
+}
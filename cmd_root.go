@@ -1,8 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/altipla-consulting/cmdbase"
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func main() {
@@ -10,6 +17,7 @@ func main() {
 }
 
 var flagDebug bool
+var flagMarker, flagConfig, flagLogFormat string
 var cmdRoot *cobra.Command
 
 func init() {
@@ -18,6 +26,71 @@ func init() {
 		"Build & run a Go app or its tests for every change.",
 		cmdbase.WithUpdate("github.com/altipla-consulting/reloader"),
 		cmdbase.WithInstall())
+	cmdRoot.PersistentFlags().StringVar(&flagMarker, "marker", ">>>", "Prefix of the status lines. Empty to remove it.")
+	cmdRoot.PersistentFlags().StringVar(&flagLogFormat, "log-format", "text", "Format of the logs of reloader: text or json. The JSON logs have the event, path and duration_ms fields for other tools.")
+	cmdRoot.PersistentFlags().StringVar(&flagConfig, "config", "", "Config file with the flags of the commands. Defaults to reloader.yaml or .reloader.yaml in the working directory if they exist.")
+
+	prerun := cmdRoot.PersistentPreRunE
+	cmdRoot.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// The global flags like --debug and --log-format are applied below, they should
+		// be read from the environment and the config file before.
+		if err := bindEnv(cmd); err != nil {
+			return errors.Trace(err)
+		}
+		if err := bindConfig(cmd); err != nil {
+			return errors.Trace(err)
+		}
+		if err := prerun(cmd, args); err != nil {
+			return errors.Trace(err)
+		}
+		switch flagLogFormat {
+		case "text":
+		case "json":
+			log.SetFormatter(new(log.JSONFormatter))
+		default:
+			return errors.Errorf("invalid --log-format %q: it should be text or json", flagLogFormat)
+		}
+		return nil
+	}
+
 	cmdRoot.AddCommand(cmdRun)
 	cmdRoot.AddCommand(cmdTest)
 }
+
+// status formats a status line of reloader with the configured marker.
+func status(format string, a ...any) string {
+	msg := fmt.Sprintf(format, a...)
+	if flagMarker == "" {
+		return msg
+	}
+	return flagMarker + " " + msg
+}
+
+// logEvent returns a logger with the name of the event and its fields in the JSON
+// log format. The text format keeps the status lines short without them.
+func logEvent(event string, fields log.Fields) *log.Entry {
+	if flagLogFormat != "json" {
+		return log.NewEntry(log.StandardLogger())
+	}
+	return log.WithFields(fields).WithField("event", event)
+}
+
+// bindEnv reads the flags of the command that were not set in the command line
+// from environment variables. For example --restart-exts reads RELOADER_RESTART_EXTS.
+func bindEnv(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed {
+			return
+		}
+		name := "RELOADER_" + strings.ToUpper(strings.ReplaceAll(flag.Name, "-", "_"))
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if serr := cmd.Flags().Set(flag.Name, value); serr != nil {
+			err = errors.Errorf("invalid %s: %v", name, serr)
+		}
+	})
+	return err
+}
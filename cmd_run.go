@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"go/build"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/altipla-consulting/errors"
+	"github.com/mattn/go-shellwords"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/slices"
@@ -25,6 +32,192 @@ var defaultIgnoreFolders = []string{
 
 type empty struct{}
 
+// buildRequest asks the app manager to rebuild the app.
+type buildRequest struct {
+	// Run the generate step before building. It is false if only generated files changed.
+	generate bool
+
+	// The declarations of the code changed, not only the body of the functions.
+	signature bool
+
+	// Changed files that caused the rebuild, to show them in the logs.
+	files []string
+}
+
+// prebuildResult is the result of a build running while the current process is
+// still serving requests.
+type prebuildResult struct {
+	id  int
+	req buildRequest
+	err error
+}
+
+// triggers connects the changes detected by the watcher with the app manager.
+type triggers struct {
+	rebuild chan buildRequest
+	restart chan empty
+	upgrade chan empty
+	reload  chan empty
+	started chan empty
+}
+
+func newTriggers() triggers {
+	return triggers{
+		rebuild: make(chan buildRequest),
+		restart: make(chan empty, 1),
+		upgrade: make(chan empty),
+		reload:  make(chan empty, 1),
+		started: make(chan empty, 1),
+	}
+}
+
+// send queues the trigger if there is not one already pending.
+func send(ch chan empty) {
+	select {
+	case ch <- empty{}:
+	default:
+	}
+}
+
+type watchOptions struct {
+	ignore  []string
+	include []string
+
+	// Maximum number of folders to watch in each tree. Unlimited if zero.
+	maxDirs int
+
+	// Optional status to count the watched folders.
+	appStatus *appStatus
+
+	// Implementation of the watcher, native by default.
+	watcher      string
+	pollInterval time.Duration
+
+	// Reuse the folders found by a previous walk if the top level folders did not change.
+	walkCache bool
+
+	// Optional .gitignore files of the repository to skip the folders they ignore.
+	gitignore *gitignore
+
+	// Walk the targets of the symlinked folders too.
+	followSymlinks bool
+}
+
+type runOptions struct {
+	// Process. The shell command runs instead of the binary of the package if set.
+	wrapper    []string
+	shell      string
+	restart    bool
+	attach     int
+	cgroup     *cgroup
+	newSession bool
+	foreground bool
+	rateLimit  int
+	noGenEnv   bool
+	env        []string
+	envFile    *envFile
+
+	// Run the app as a task that finishes, the exit codes of successCodes are not
+	// errors.
+	task         bool
+	successCodes []int
+
+	// Prefix of the output lines of the app and the build, to tell them apart from
+	// the logs of reloader and the other apps.
+	outputPrefix string
+	buildPrefix  string
+
+	// Signals to stop the process when restarting it and when reloader exits.
+	stopSignal      os.Signal
+	finalStopSignal os.Signal
+
+	// Automatic restarts of a failing process. The delay grows by the factor after
+	// every restart up to the maximum. Unlimited restarts if maxRestarts is zero.
+	restartOnSuccess bool
+	maxRestarts      int
+	restartDelay     time.Duration
+	restartMaxDelay  time.Duration
+	restartFactor    float64
+
+	// Time to wait before warning that the process is closing and before killing it.
+	stopGrace   time.Duration
+	stopTimeout time.Duration
+
+	// Changes.
+	watchExts     []string
+	rebuildExts   []string
+	restartExts   []string
+	upgradeExts   []string
+	upgradeSignal os.Signal
+	reloadSignal  os.Signal
+	restartFiles  []string
+	restartMatch  *regexp.Regexp
+	startupIgnore time.Duration
+	debounce      time.Duration
+	idle          time.Duration
+	gitDebounce   time.Duration
+	countChanges  bool
+
+	// Build.
+	generate    string
+	generated   []string
+	schemaDirs  []string
+	schemaExts  []string
+	astDiff     bool
+	signatures  *signatureCache
+	noBuild     bool
+	prebuild    bool
+	quietBuild  bool
+	logBuild    bool
+	output      string
+	bin         string
+	buildCmd    []string
+	tags        string
+	race        bool
+	buildFlags  []string
+	buildFilter *regexp.Regexp
+	buildPath   []string
+	maxLoad     float64
+	failOnBuild bool
+
+	// Run the installed binary when starting up instead of building it first.
+	noInitialBuild bool
+
+	// Order of the starts of several apps. The app waits for the previous one to
+	// start if both are restarting, and then the stagger delay.
+	start     *startOrder
+	prevStart *startOrder
+	stagger   time.Duration
+
+	// Hooks.
+	preBuild         string
+	postBuild        string
+	onSignature      string
+	preRestart       string
+	preRestartStrict bool
+	onReady          string
+	onBuildFail      string
+	onBuildSuccess   string
+	onChange         []changeHook
+
+	// Remote builder. The process runs in the remote host too if remoteRun is set.
+	remote    *remoteHost
+	remoteRun bool
+	sshSync   string
+
+	// Readiness.
+	waitPort        int
+	waitPortTimeout time.Duration
+	healthURL       string
+	healthTimeout   time.Duration
+
+	// Reporting.
+	proxy     *devProxy
+	appStatus *appStatus
+	cycles    *cycleLog
+	webhook   *webhook
+}
+
 var cmdRun = &cobra.Command{
 	Use:     "run",
 	Example: "reloader run -r ./backend",
@@ -33,76 +226,915 @@ var cmdRun = &cobra.Command{
 }
 
 func init() {
-	var flagWatch, flagIgnore []string
-	var flagRestartExts []string
-	var flagRestart bool
-	cmdRun.PersistentFlags().StringSliceVarP(&flagWatch, "watch", "w", nil, "Folders to watch recursively for changes.")
-	cmdRun.PersistentFlags().StringSliceVarP(&flagIgnore, "ignore", "g", nil, "Folders to ignore.")
+	var flagWatch, flagIgnore, flagInclude, flagRestartFiles, flagBuildPath, flagGenerated []string
+	var flagSchemaDirs, flagSchemaExts []string
+	var flagRestartExts, flagUpgradeExts, flagEnv, flagWatchExts, flagRebuildExts, flagOnChange []string
+	var flagRestart, flagCountChanges, flagFailOnBuild, flagNoBuild, flagQuietBuild, flagNewSession bool
+	var flagPreRestartStrict, flagTUI, flagASTDiff, flagNoGenEnv, flagSSHRun, flagWalkCache, flagPrebuild, flagClear bool
+	var flagBuildVerbose, flagRestartOnSuccess, flagOnce, flagPrefix, flagNoInitialBuild, flagUseGitignore bool
+	var flagFollowSymlinks, flagRace, flagForeground, flagTask bool
+	var flagSuccessCodes []int
+	var flagWrapper, flagProxy, flagProxyTarget, flagOnReady, flagListen string
+	var flagOnBuildFail, flagOnBuildSuccess, flagUpgradeSignal, flagGenerate, flagPreRestart string
+	var flagStopSignal, flagFinalStopSignal, flagOnSignature, flagWatcher, flagReloadSignal string
+	var flagStartupIgnore, flagIdle, flagGitDebounce, flagDebounce, flagStopTimeout, flagStopGrace time.Duration
+	var flagWaitPortTimeout, flagHealthTimeout, flagRestartDelay, flagRestartMaxDelay, flagPollInterval, flagStagger time.Duration
+	var flagMaxLoad, flagCPULimit, flagRestartFactor float64
+	var flagMemLimit, flagBuildFilter, flagWatchConfig, flagOutput, flagRestartMatch string
+	var flagSSH, flagSSHDir, flagSSHSync, flagBuildFlags, flagBuildCmd, flagBin, flagEnvFile string
+	var flagPreBuild, flagPostBuild, flagTags, flagHealthURL, flagWebhook, flagShell string
+	var flagAttach, flagMaxWatchedDirs, flagRateLimit, flagQuietAfter, flagWaitPort, flagMaxRestarts int
+	cmdRun.PersistentFlags().StringSliceVarP(&flagWatch, "watch", "w", nil, "Folders to watch recursively for changes, or glob patterns of files like './config/*.yaml'. A ** matches any number of nested folders.")
+	cmdRun.PersistentFlags().StringSliceVarP(&flagIgnore, "ignore", "g", nil, "Folders to ignore. A name without slashes like 'build' ignores the folders with that name at any depth.")
+	cmdRun.PersistentFlags().StringVar(&flagWatcher, "watcher", watcherNative, watcherUsage)
+	cmdRun.PersistentFlags().DurationVar(&flagPollInterval, "poll-interval", defaultPollInterval, pollIntervalUsage)
+	cmdRun.PersistentFlags().StringVar(&flagWatchConfig, "watch-config", "", "YAML file with more 'watch' and 'ignore' folders. Changes to the file are applied without restarting reloader.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagInclude, "include", nil, "Glob patterns of the only folders to watch. Ignored folders are still excluded.")
+	cmdRun.PersistentFlags().BoolVar(&flagWalkCache, "walk-cache", false, "Save the watched folders in disk and reuse them when starting again if the top level folders did not change, to start faster in huge repositories.")
+	cmdRun.PersistentFlags().BoolVar(&flagUseGitignore, "use-gitignore", false, "Do not watch the folders ignored by the .gitignore files of the repository, including the nested ones.")
+	cmdRun.PersistentFlags().BoolVar(&flagFollowSymlinks, "follow-symlinks", false, "Watch the targets of the symlinked folders inside the watched ones, like a shared package linked in the tree.")
+	cmdRun.PersistentFlags().IntVar(&flagMaxWatchedDirs, "max-watched-dirs", 10000, "Maximum number of folders to watch in each tree, to avoid watching a huge tree by mistake. Disabled if zero.")
 	cmdRun.PersistentFlags().BoolVarP(&flagRestart, "restart", "r", false, "Automatic restart in case of failure.")
+	cmdRun.PersistentFlags().BoolVar(&flagTask, "task", false, "Run the app as a task that finishes, like a generator or a script, after every change. Its exit code is reported as a success or a failure.")
+	cmdRun.PersistentFlags().IntSliceVar(&flagSuccessCodes, "success-codes", []int{0}, "Exit codes of the --task that count as a success, for example '0,1' for diff. The other codes are failures.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagWatchExts, "watch-exts", nil, "List of the only extensions whose changes are taken into account, for example '.go,.html,.sql'. The rest of changes are ignored.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagRebuildExts, "rebuild-exts", nil, "List of extensions that rebuild the app like Go files, for inputs of the code generation like '.templ'.")
+	cmdRun.PersistentFlags().BoolVar(&flagRestartOnSuccess, "restart-on-success", true, "Restart the app automatically with --restart when it exits with code 0 too. Disable it for apps that finish their work.")
+	cmdRun.PersistentFlags().IntVar(&flagMaxRestarts, "max-restarts", 0, "Maximum number of consecutive automatic restarts of a failing app before waiting for a change to restart it. Unlimited if zero.")
+	cmdRun.PersistentFlags().DurationVar(&flagRestartDelay, "restart-delay", time.Second, "Time to wait before the first automatic restart of a failing app.")
+	cmdRun.PersistentFlags().DurationVar(&flagRestartMaxDelay, "restart-max-delay", 8*time.Second, "Maximum time to wait before the automatic restarts of a failing app.")
+	cmdRun.PersistentFlags().Float64Var(&flagRestartFactor, "restart-factor", 2, "Multiplier of the time to wait after every consecutive automatic restart. Use 1 for a constant delay.")
 	cmdRun.PersistentFlags().StringSliceVarP(&flagRestartExts, "restart-exts", "e", nil, "List of extensions that cause the app to restart.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagUpgradeExts, "upgrade-exts", nil, "List of extensions that rebuild the app and send --upgrade-signal to the running process instead of restarting it.")
+	cmdRun.PersistentFlags().StringVar(&flagUpgradeSignal, "upgrade-signal", "SIGUSR1", "Signal sent to the running process after rebuilding it because of --upgrade-exts.")
+	cmdRun.PersistentFlags().StringVar(&flagReloadSignal, "reload-signal", "", "Signal sent to the running process instead of restarting it when the files of --restart-exts or --restart-files change, for apps that reload their config in place like with SIGHUP.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagRestartFiles, "restart-files", nil, "Files that cause the app to restart when changed, even if they are outside the watched folders.")
+	cmdRun.PersistentFlags().StringVar(&flagRestartMatch, "restart-on-match", "", "Regular expression of the output lines of the app that restart it, for example 'config changed, please restart'.")
+	cmdRun.PersistentFlags().BoolVar(&flagOnce, "once", false, "Build and run the app a single time without watching for changes, exiting with the exit code of the app. Useful to check the build in CI.")
+	cmdRun.PersistentFlags().BoolVar(&flagFailOnBuild, "fail-on-build-error", false, "Exit with an error if the first build fails instead of waiting for changes.")
+	cmdRun.PersistentFlags().BoolVar(&flagCountChanges, "count-changes", false, "Print a report of the change events by extension and folder when exiting, to find noisy folders.")
+	cmdRun.PersistentFlags().DurationVar(&flagDebounce, "debounce", 50*time.Millisecond, "Wait this time after a change to group it with the next ones before rebuilding or restarting, for example '250ms' for editors that save in several bursts.")
+	cmdRun.PersistentFlags().DurationVar(&flagIdle, "defer-restart-until-idle", 0, "Wait until there are no change events of any file during this time before rebuilding or restarting.")
+	cmdRun.PersistentFlags().DurationVar(&flagGitDebounce, "git-debounce", time.Second, "Wait this time after a git operation like switching branches to rebuild only once for all its file changes. Disabled if zero.")
+	cmdRun.PersistentFlags().DurationVar(&flagStartupIgnore, "startup-ignore-window", 0, "Ignore changes during this time after the app starts, to avoid reloads caused by its own startup writes.")
+	cmdRun.PersistentFlags().IntVar(&flagAttach, "attach", 0, "PID of an already running instance of the app to supervise instead of starting a new one.")
+	cmdRun.PersistentFlags().Float64Var(&flagMaxLoad, "max-load", 0, "Delay builds while the system load average is above this value. Disabled if zero.")
+	cmdRun.PersistentFlags().StringVar(&flagGenerate, "generate", "", "Shell command to generate code before every build, for example 'go generate ./...'.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagGenerated, "generated", nil, "Folders or glob patterns of generated files. Their changes rebuild the app without running --generate again.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagSchemaDirs, "schema-dir", nil, "Folders with API schemas to watch. Their changes run --generate, rebuild and restart the app.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagSchemaExts, "schema-exts", []string{".proto", ".yaml"}, "List of extensions of the API schemas inside --schema-dir.")
+	cmdRun.PersistentFlags().BoolVar(&flagASTDiff, "ast-diff", false, "Compare the declarations of the changed Go files to skip --generate when only the body of the functions changed.")
+	cmdRun.PersistentFlags().StringVar(&flagOnSignature, "on-signature-change", "", "Shell command to run after a successful build when the imports, types or signatures changed. It enables --ast-diff.")
+	cmdRun.PersistentFlags().BoolVar(&flagNoBuild, "no-build", false, "Do not build the app, only restart the installed binary when files change. Useful if another tool builds it.")
+	cmdRun.PersistentFlags().BoolVar(&flagNoInitialBuild, "no-initial-build", false, "Run the installed binary when starting instead of building it first. It is built anyway if it does not exist.")
+	cmdRun.PersistentFlags().BoolVar(&flagPrebuild, "prebuild", false, "Build the new version while the app keeps running and restart it only when the build succeeds, to reduce the time it is down. Not available in Windows.")
+	cmdRun.PersistentFlags().StringVarP(&flagOutput, "output", "o", "", "Build the binary in this path with go build instead of installing it in GOPATH/bin, for example if it is read-only.")
+	cmdRun.PersistentFlags().StringVar(&flagBuildCmd, "build-cmd", "", "Command to build the app instead of go install, for example './scripts/build.sh'. Use --bin if the binary is not installed in GOPATH/bin.")
+	cmdRun.PersistentFlags().StringVar(&flagBin, "bin", "", "Path of the binary to run, if it is not the one installed in GOPATH/bin or built with --output.")
+	cmdRun.PersistentFlags().StringVarP(&flagTags, "tags", "t", "", "Tags for the go build command.")
+	cmdRun.PersistentFlags().BoolVar(&flagRace, "race", false, "Build the app with the race detector to find data races while developing.")
+	cmdRun.PersistentFlags().StringVar(&flagBuildFlags, "build-flags", "", "Flags for the build command inserted before the package, for example \"-ldflags '-X main.version=dev' -trimpath\".")
+	cmdRun.PersistentFlags().BoolVar(&flagBuildVerbose, "build-verbose", false, "Print the build command with all its arguments and the environment variables it receives before running it.")
+	cmdRun.PersistentFlags().BoolVar(&flagQuietBuild, "quiet-build", false, "Hide the output of the build unless it fails.")
+	cmdRun.PersistentFlags().StringVar(&flagBuildFilter, "build-filter", "", "Regular expression of the lines to hide from the output of successful builds, for example '^go: downloading'. Failed builds show the whole output.")
+	cmdRun.PersistentFlags().StringSliceVar(&flagBuildPath, "build-path", nil, "Folders to prepend to the PATH of the build command and the generate step, for code generation tools.")
+	cmdRun.PersistentFlags().Float64Var(&flagCPULimit, "cpu-limit", 0, "Limit the number of CPUs of the app, it can be fractional. Only available in Linux with cgroups v2.")
+	cmdRun.PersistentFlags().StringVar(&flagMemLimit, "mem-limit", "", "Limit the memory of the app, for example 512M. Only available in Linux with cgroups v2.")
+	cmdRun.PersistentFlags().BoolVar(&flagForeground, "foreground", false, "Keep the app in the foreground process group of the terminal to read from it. The processes it spawns are not stopped together with it then. Not available in Windows.")
+	cmdRun.PersistentFlags().BoolVar(&flagNewSession, "new-session", false, "Run the app in a new session detached from the terminal, so only reloader can stop it. The app cannot read from the terminal in this mode. Not available in Windows.")
+	cmdRun.PersistentFlags().IntVar(&flagRateLimit, "rate-limit-output", 0, "Maximum number of lines per second of the output of the app, the rest are dropped and counted. Disabled if zero.")
+	cmdRun.PersistentFlags().StringVar(&flagStopSignal, "stop-signal", "SIGINT", "Signal sent to stop the app before restarting it.")
+	cmdRun.PersistentFlags().StringVar(&flagFinalStopSignal, "final-stop-signal", "", "Signal sent to stop the app when reloader exits. Defaults to --stop-signal.")
+	cmdRun.PersistentFlags().StringArrayVar(&flagEnv, "env", nil, "Environment variable for the app and the build as KEY=VALUE, overriding the inherited value. It can be repeated.")
+	cmdRun.PersistentFlags().StringVar(&flagEnvFile, "env-file", "", "Dotenv file with environment variables for the app and the build. It is read again before every build and restart. The --env variables take precedence.")
+	cmdRun.PersistentFlags().DurationVar(&flagStopTimeout, "stop-timeout", 15*time.Second, "Time to wait for the app to stop after the stop signal before killing it.")
+	cmdRun.PersistentFlags().DurationVar(&flagStopGrace, "stop-grace", 3*time.Second, "Time to wait for the app to stop before reporting that it is still closing. It should be shorter than --stop-timeout.")
+	cmdRun.PersistentFlags().BoolVar(&flagNoGenEnv, "no-generation-env", false, "Do not set the RELOADER_GENERATION environment variable with the number of times the app has been started.")
+	cmdRun.PersistentFlags().StringVar(&flagShell, "shell", "", "Shell command to run instead of building and running a Go app, for example 'make serve'. The argument is only the folder to watch.")
+	cmdRun.PersistentFlags().StringVar(&flagWrapper, "wrapper", "", "Command to prepend to the binary invocation, for example 'nice -n 10'.")
+	cmdRun.PersistentFlags().StringVar(&flagPreBuild, "pre-build", "", "Shell command to run before every build, after --generate. If it fails the build is skipped and the app keeps running.")
+	cmdRun.PersistentFlags().StringVar(&flagPostBuild, "post-build", "", "Shell command to run after every successful build, before restarting the app. If it fails the build is reported as failed.")
+	cmdRun.PersistentFlags().StringVar(&flagPreRestart, "pre-restart", "", "Shell command to run right before stopping the app to restart it. Failures are logged and the restart continues.")
+	cmdRun.PersistentFlags().BoolVar(&flagPreRestartStrict, "pre-restart-strict", false, "Cancel the restart and keep the app running if the --pre-restart command fails.")
+	cmdRun.PersistentFlags().IntVar(&flagWaitPort, "wait-port", 0, "Wait until the app accepts connections in this port of localhost to report it as ready and run --on-ready. Disabled if zero.")
+	cmdRun.PersistentFlags().DurationVar(&flagWaitPortTimeout, "wait-port-timeout", 30*time.Second, "Maximum time to wait for the port of --wait-port. The app keeps running but it is not reported as ready after it.")
+	cmdRun.PersistentFlags().StringVar(&flagHealthURL, "health-url", "", "URL of the app that returns a 2xx status when it is ready, for example 'http://localhost:8080/health'. It is requested until it passes to report the app as ready and run --on-ready.")
+	cmdRun.PersistentFlags().DurationVar(&flagHealthTimeout, "health-timeout", 30*time.Second, "Maximum time to wait for --health-url to pass. The app keeps running but it is not reported as ready after it.")
+	cmdRun.PersistentFlags().StringVar(&flagOnReady, "on-ready", "", "Shell command to run every time the app is ready after a restart. Failures are logged but ignored.")
+	cmdRun.PersistentFlags().StringArrayVar(&flagOnChange, "on-change", nil, "Shell command to run when the files of an extension change, as EXT:COMMAND like '.sql:go run ./cmd/migrate'. It does not rebuild nor restart the app and failures are logged. It can be repeated.")
+	cmdRun.PersistentFlags().StringVar(&flagOnBuildFail, "on-build-fail", "", "Shell command to run when the build fails. It receives the output of the build in the standard input.")
+	cmdRun.PersistentFlags().StringVar(&flagOnBuildSuccess, "on-build-success", "", "Shell command to run when the build succeeds, before restarting the app.")
+	cmdRun.PersistentFlags().StringVar(&flagSSH, "ssh", "", "Build the app in a remote host through ssh, for example 'user@devbox'. The sources should be shared with a mount or synced with --ssh-sync.")
+	cmdRun.PersistentFlags().StringVar(&flagSSHDir, "ssh-dir", "", "Folder of the sources in the remote host of --ssh. Defaults to the current folder.")
+	cmdRun.PersistentFlags().BoolVar(&flagSSHRun, "ssh-run", false, "Run the app in the remote host of --ssh too, instead of only building it.")
+	cmdRun.PersistentFlags().StringVar(&flagSSHSync, "ssh-sync", "", "Shell command to run locally before every remote build to sync the sources, for example 'rsync -a --delete ./ devbox:src/myapp'.")
+	cmdRun.PersistentFlags().IntVar(&flagQuietAfter, "quiet-after", 0, "Print a single compact line per reload after this number of successful reloads, instead of every status line. A build failure restores them. Disabled if zero.")
+	cmdRun.PersistentFlags().BoolVar(&flagClear, "clear", false, "Clear the terminal before every build or restart to show only the output of the last run. Disabled if the output is not a terminal.")
+	cmdRun.PersistentFlags().BoolVar(&flagPrefix, "prefix", false, "Prefix every line of the output of the app with its name, and the output of the build with [build]. The output of several apps is always prefixed.")
+	cmdRun.PersistentFlags().DurationVar(&flagStagger, "stagger", 0, "Start several apps one after another, waiting this time after the previous app starts when they restart together, to avoid overloading the shared dependencies.")
+	cmdRun.PersistentFlags().BoolVar(&flagTUI, "tui", false, "Show a status bar with the state of the app at the bottom of the terminal. The output scrolls above it as usual.")
+	cmdRun.PersistentFlags().StringVar(&flagWebhook, "webhook", "", "URL to post the build and restart events in JSON, for example to report them to a shared dashboard. Errors are logged and ignored.")
+	cmdRun.PersistentFlags().StringVar(&flagListen, "listen", "", "Address to listen for the control server, for example 'localhost:9000'. GET /status returns the state of the app in JSON.")
+	cmdRun.PersistentFlags().StringVar(&flagProxy, "proxy", "", "Address to listen for a development proxy that shows build errors in the browser, for example ':3000'.")
+	cmdRun.PersistentFlags().StringVar(&flagProxyTarget, "proxy-target", "http://localhost:8080", "URL of the app the development proxy forwards requests to.")
 
 	cmdRun.RunE = func(cmd *cobra.Command, args []string) error {
+		opts := runOptions{
+			restart:          flagRestart,
+			restartOnSuccess: flagRestartOnSuccess,
+			maxRestarts:      flagMaxRestarts,
+			restartDelay:     flagRestartDelay,
+			restartMaxDelay:  flagRestartMaxDelay,
+			restartFactor:    flagRestartFactor,
+			watchExts:        flagWatchExts,
+			rebuildExts:      flagRebuildExts,
+			restartExts:      flagRestartExts,
+			appStatus:        newAppStatus(),
+			cycles:           newCycleLog(flagQuietAfter, flagClear),
+			startupIgnore:    flagStartupIgnore,
+			maxLoad:          flagMaxLoad,
+			attach:           flagAttach,
+			preRestart:       flagPreRestart,
+			preRestartStrict: flagPreRestartStrict,
+			onReady:          flagOnReady,
+			waitPort:         flagWaitPort,
+			waitPortTimeout:  flagWaitPortTimeout,
+			healthURL:        flagHealthURL,
+			healthTimeout:    flagHealthTimeout,
+			onBuildFail:      flagOnBuildFail,
+			onBuildSuccess:   flagOnBuildSuccess,
+			countChanges:     flagCountChanges,
+			debounce:         flagDebounce,
+			stopGrace:        flagStopGrace,
+			stopTimeout:      flagStopTimeout,
+			idle:             flagIdle,
+			gitDebounce:      flagGitDebounce,
+			buildPath:        flagBuildPath,
+			failOnBuild:      flagFailOnBuild,
+			noBuild:          flagNoBuild,
+			prebuild:         flagPrebuild,
+			noInitialBuild:   flagNoInitialBuild,
+			quietBuild:       flagQuietBuild,
+			tags:             flagTags,
+			race:             flagRace,
+			logBuild:         flagBuildVerbose,
+			newSession:       flagNewSession,
+			foreground:       flagForeground,
+			rateLimit:        flagRateLimit,
+			noGenEnv:         flagNoGenEnv,
+			env:              flagEnv,
+			generate:         flagGenerate,
+			generated:        flagGenerated,
+			schemaExts:       flagSchemaExts,
+			astDiff:          flagASTDiff || flagOnSignature != "",
+			onSignature:      flagOnSignature,
+			preBuild:         flagPreBuild,
+			postBuild:        flagPostBuild,
+			sshSync:          flagSSHSync,
+			shell:            flagShell,
+			stagger:          flagStagger,
+			task:             flagTask,
+			successCodes:     flagSuccessCodes,
+		}
+
+		if opts.task && (opts.restart || opts.restartOnSuccess) {
+			return errors.Errorf("--task cannot be combined with --restart or --restart-on-success, it runs again after every change")
+		}
+		if cmd.Flags().Changed("success-codes") && !opts.task {
+			return errors.Errorf("--success-codes requires --task")
+		}
+		if opts.newSession && opts.foreground {
+			return errors.Errorf("--new-session cannot be combined with --foreground")
+		}
+		if opts.prebuild && runtime.GOOS == "windows" {
+			return errors.Errorf("--prebuild is not available in Windows")
+		}
+
+		if opts.shell != "" {
+			if len(args) > 1 {
+				return errors.Errorf("--shell only accepts the folder to watch, use --watch for more folders")
+			}
+			if flagWrapper != "" || flagSSHRun {
+				return errors.Errorf("--shell cannot be combined with --wrapper or --ssh-run")
+			}
+			opts.noBuild = true
+		}
+
+		if opts.debounce <= 0 {
+			return errors.Errorf("invalid --debounce %s: it should be greater than zero", opts.debounce)
+		}
+
+		if opts.stopGrace <= 0 || opts.stopTimeout <= 0 {
+			return errors.Errorf("invalid --stop-grace %s and --stop-timeout %s: they should be greater than zero", opts.stopGrace, opts.stopTimeout)
+		}
+		if opts.stopGrace >= opts.stopTimeout {
+			return errors.Errorf("invalid --stop-grace %s: it should be shorter than --stop-timeout %s", opts.stopGrace, opts.stopTimeout)
+		}
+		if opts.restartDelay < 0 || opts.restartMaxDelay < opts.restartDelay {
+			return errors.Errorf("invalid --restart-max-delay %s: it should be greater or equal than --restart-delay %s", opts.restartMaxDelay, opts.restartDelay)
+		}
+		if opts.restartFactor < 1 {
+			return errors.Errorf("invalid --restart-factor %v: it should be greater or equal than 1", opts.restartFactor)
+		}
+		if flagWaitPort < 0 || flagWaitPort > 65535 {
+			return errors.Errorf("invalid --wait-port %d", flagWaitPort)
+		}
+		if flagStagger < 0 {
+			return errors.Errorf("invalid --stagger %s: it should not be negative", flagStagger)
+		}
+		if flagQuietAfter < 0 {
+			return errors.Errorf("invalid --quiet-after %d: it should not be negative", flagQuietAfter)
+		}
+
+		for _, v := range flagOnChange {
+			hook, err := parseChangeHook(v)
+			if err != nil {
+				return errors.Errorf("invalid --on-change %q: %v", v, err)
+			}
+			opts.onChange = append(opts.onChange, hook)
+		}
+
+		for _, v := range opts.env {
+			if name, _, ok := strings.Cut(v, "="); !ok || name == "" {
+				return errors.Errorf("invalid --env %q: it should be KEY=VALUE", v)
+			}
+		}
+
+		var err error
+		if flagEnvFile != "" {
+			opts.envFile, err = newEnvFile(flagEnvFile)
+			if err != nil {
+				return errors.Errorf("invalid --env-file: %v", err)
+			}
+		}
+		opts.wrapper, err = shellwords.Parse(flagWrapper)
+		if err != nil {
+			return errors.Errorf("invalid --wrapper: %v", err)
+		}
+		opts.buildFlags, err = shellwords.Parse(flagBuildFlags)
+		if err != nil {
+			return errors.Errorf("invalid --build-flags: %v", err)
+		}
+		opts.buildCmd, err = shellwords.Parse(flagBuildCmd)
+		if err != nil {
+			return errors.Errorf("invalid --build-cmd: %v", err)
+		}
+		if len(opts.buildCmd) > 0 && (flagOutput != "" || len(opts.buildFlags) > 0 || opts.tags != "" || opts.race) {
+			return errors.Errorf("--output, --tags, --race and --build-flags only apply to go build, use --bin to run the binary of --build-cmd")
+		}
+		if len(flagUpgradeExts) > 0 {
+			opts.upgradeExts = flagUpgradeExts
+			opts.upgradeSignal, err = parseSignal(flagUpgradeSignal)
+			if err != nil {
+				return errors.Errorf("invalid --upgrade-signal: %v", err)
+			}
+		}
+		if flagReloadSignal != "" {
+			opts.reloadSignal, err = parseSignal(flagReloadSignal)
+			if err != nil {
+				return errors.Errorf("invalid --reload-signal: %v", err)
+			}
+		}
+
+		if flagSSH != "" {
+			dir := flagSSHDir
+			if dir == "" {
+				dir, err = os.Getwd()
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+			opts.remote = newRemoteHost(flagSSH, dir)
+			opts.remoteRun = flagSSHRun
+		} else if flagSSHRun || flagSSHDir != "" || flagSSHSync != "" {
+			return errors.Errorf("--ssh-run, --ssh-dir and --ssh-sync require a --ssh host")
+		}
+		if opts.remoteRun && opts.attach > 0 {
+			return errors.Errorf("--attach cannot supervise a process running in the remote host of --ssh")
+		}
+		if flagOnce && opts.attach > 0 {
+			return errors.Errorf("--once cannot be combined with --attach")
+		}
+
+		// The remote commands run in the remote folder, the relative path is resolved there.
+		if flagOutput != "" && opts.remote == nil {
+			opts.output, err = filepath.Abs(flagOutput)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		} else {
+			opts.output = flagOutput
+		}
+		opts.bin = opts.output
+		if flagBin != "" && opts.remote == nil {
+			opts.bin, err = filepath.Abs(flagBin)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		} else if flagBin != "" {
+			opts.bin = flagBin
+		}
+		if flagRestartMatch != "" {
+			opts.restartMatch, err = regexp.Compile(flagRestartMatch)
+			if err != nil {
+				return errors.Errorf("invalid --restart-on-match: %v", err)
+			}
+		}
+		if flagBuildFilter != "" {
+			opts.buildFilter, err = regexp.Compile(flagBuildFilter)
+			if err != nil {
+				return errors.Errorf("invalid --build-filter: %v", err)
+			}
+		}
+
+		opts.stopSignal, err = parseSignal(flagStopSignal)
+		if err != nil {
+			return errors.Errorf("invalid --stop-signal: %v", err)
+		}
+		opts.finalStopSignal = opts.stopSignal
+		if flagFinalStopSignal != "" {
+			opts.finalStopSignal, err = parseSignal(flagFinalStopSignal)
+			if err != nil {
+				return errors.Errorf("invalid --final-stop-signal: %v", err)
+			}
+		}
+
+		limits := resourceLimits{cpu: flagCPULimit}
+		limits.memory, err = parseMemory(flagMemLimit)
+		if err != nil {
+			return errors.Errorf("invalid --mem-limit: %v", err)
+		}
+		if limits.enabled() {
+			opts.cgroup, err = newCgroup(limits)
+			if err != nil {
+				log.WithField("error", err.Error()).Warning("Cannot limit the resources of the app, it will run unconstrained")
+			}
+			defer opts.cgroup.Remove()
+		}
+
+		apps, appArgs := splitApps(args)
+		if len(apps) > 1 && (flagOnce || opts.attach > 0 || opts.bin != "" || flagListen != "" || flagTUI) {
+			return errors.Errorf("--once, --attach, --output, --bin, --listen and --tui only support one app")
+		}
+		appOptions := func(i int, app string) (runOptions, error) {
+			appOpts := opts
+			if len(apps) > 1 {
+				// The state and the remote process of every app are tracked separately.
+				appOpts.appStatus = newAppStatus()
+				appOpts.cycles = newCycleLog(flagQuietAfter, flagClear)
+				if opts.remote != nil {
+					remote := *opts.remote
+					remote.pidFile = fmt.Sprintf("/tmp/reloader-%d-%d.pid", os.Getpid(), i)
+					appOpts.remote = &remote
+				}
+			}
+			if len(apps) > 1 || flagPrefix {
+				name, err := appName(app)
+				if err != nil {
+					return appOpts, errors.Trace(err)
+				}
+				appOpts.outputPrefix = "[" + name + "] "
+			}
+			if flagPrefix {
+				appOpts.buildPrefix = "[build] "
+			}
+			if flagWebhook != "" {
+				appOpts.webhook = newWebhook(flagWebhook, app)
+			}
+			return appOpts, nil
+		}
+
+		if flagOnce {
+			onceOpts, err := appOptions(0, apps[0])
+			if err != nil {
+				return errors.Trace(err)
+			}
+			code, err := runOnce(cmd.Context(), args, onceOpts)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if code != 0 {
+				// os.Exit does not run the deferred cleanups.
+				opts.cgroup.Remove()
+				os.Exit(code)
+			}
+			return nil
+		}
+
 		grp, ctx := errgroup.WithContext(cmd.Context())
 
-		changes := make(chan string)
-		for _, folder := range flagWatch {
-			grp.Go(watchFolder(ctx, changes, flagIgnore, folder))
+		if flagProxy != "" {
+			opts.proxy, err = newDevProxy(flagProxyTarget)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			grp.Go(serveHTTP(ctx, "Development proxy", flagProxy, opts.proxy))
+		}
+		if flagListen != "" {
+			grp.Go(serveHTTP(ctx, "Control server", flagListen, controlHandler(opts.appStatus)))
+		}
+		if flagTUI {
+			grp.Go(runStatusBar(ctx, opts.appStatus))
+		}
+
+		wopts := watchOptions{
+			ignore:         flagIgnore,
+			include:        flagInclude,
+			maxDirs:        flagMaxWatchedDirs,
+			appStatus:      opts.appStatus,
+			watcher:        flagWatcher,
+			pollInterval:   flagPollInterval,
+			walkCache:      flagWalkCache,
+			followSymlinks: flagFollowSymlinks,
+		}
+		if err := checkWatcher(wopts.watcher, wopts.pollInterval); err != nil {
+			return errors.Trace(err)
+		}
+		if flagUseGitignore {
+			dir := findGitDir()
+			if dir == "" {
+				return errors.Errorf("--use-gitignore requires a git repository")
+			}
+			wopts.gitignore = newGitignore(filepath.Dir(dir))
+		}
+		for _, pattern := range wopts.include {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return errors.Errorf("invalid --include %q: %v", pattern, err)
+			}
 		}
-		grp.Go(watchFolder(ctx, changes, flagIgnore, args[0]))
 
-		rebuild := make(chan empty)
-		restart := make(chan empty, 1)
-		grp.Go(receiveWatchChanges(ctx, changes, flagRestartExts, rebuild, restart))
+		if len(flagSchemaDirs) > 0 && opts.generate == "" {
+			return errors.Errorf("--schema-dir requires a --generate command")
+		}
+		for _, dir := range flagSchemaDirs {
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			opts.schemaDirs = append(opts.schemaDirs, abs)
+		}
 
-		grp.Go(appManager(ctx, args, flagRestart, rebuild, restart))
+		for _, file := range flagRestartFiles {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			opts.restartFiles = append(opts.restartFiles, abs)
+		}
+		// The variables are read again when the app restarts, a change of the file
+		// applies them.
+		if flagEnvFile != "" {
+			abs, err := filepath.Abs(flagEnvFile)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			opts.restartFiles = append(opts.restartFiles, abs)
+		}
+
+		// Only the Go builds of reloader include the modules of the workspace.
+		var modules []string
+		if !opts.noBuild {
+			modules, err = workspaceModules(ctx)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		// Every app has its own watchers and triggers, so a change in the package of
+		// one of them does not restart the others.
+		var prevStart *startOrder
+		for i, app := range apps {
+			appOpts, err := appOptions(i, app)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if len(apps) > 1 && opts.stagger > 0 {
+				appOpts.start = newStartOrder()
+				appOpts.prevStart = prevStart
+				prevStart = appOpts.start
+			}
+			appWopts := wopts
+			appWopts.appStatus = appOpts.appStatus
+
+			changes := make(chan string)
+			if len(opts.restartFiles) > 0 {
+				grp.Go(watchRestartFiles(ctx, changes, opts.restartFiles))
+			}
+			if opts.gitDebounce > 0 {
+				if dir := findGitDir(); dir != "" {
+					grp.Go(func() error {
+						return errors.Trace(watch.Files(ctx, changes, dir))
+					})
+				}
+			}
+			folders := append(append([]string{app}, flagWatch...), flagSchemaDirs...)
+			unwatched, err := unwatchedModules(folders, modules)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			folders = append(folders, unwatched...)
+			if opts.astDiff {
+				appOpts.signatures = newSignatureCache()
+				grp.Go(appOpts.signatures.Load(ctx, appWopts, folders))
+			}
+			if flagWatchConfig != "" {
+				grp.Go(watchScope(ctx, changes, appWopts, folders, flagWatchConfig))
+			} else {
+				for _, folder := range folders {
+					grp.Go(watchFolder(ctx, changes, appWopts, folder))
+				}
+			}
+
+			trig := newTriggers()
+			grp.Go(receiveWatchChanges(ctx, changes, appOpts, trig))
+
+			grp.Go(appManager(ctx, append([]string{app}, appArgs...), appOpts, trig))
+		}
 
 		return errors.Trace(grp.Wait())
 	}
 }
 
-func watchFolder(ctx context.Context, changes chan string, ignore []string, folder string) func() error {
+// splitApps separates the packages of the apps to run from the arguments passed to
+// them. The first argument is always an app, the next ones are apps too while they
+// are local folders of a main package.
+func splitApps(args []string) ([]string, []string) {
+	for i := 1; i < len(args); i++ {
+		if !build.IsLocalImport(args[i]) && !filepath.IsAbs(args[i]) {
+			return args[:i], args[i:]
+		}
+		pkg, err := build.ImportDir(args[i], 0)
+		if err != nil || pkg.Name != "main" {
+			return args[:i], args[i:]
+		}
+	}
+	return args, nil
+}
+
+func watchFolder(ctx context.Context, changes chan string, opts watchOptions, folder string) func() error {
+	if isGlob(folder) {
+		return watchGlob(ctx, changes, opts, folder)
+	}
+
+	switch opts.watcher {
+	case watcherRecursive:
+		return watchRecursive(ctx, changes, opts, folder)
+	case watcherPoll:
+		return pollFolder(ctx, changes, opts, folder)
+	}
+
 	return func() error {
 		var paths []string
-		walkFn := func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				if os.IsNotExist(err) {
+		var err error
+		if opts.walkCache {
+			paths, err = cachedWalkFolders(opts, folder)
+		} else {
+			paths, err = walkFolders(opts, folder, nil)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		watched := make(map[string]bool)
+		for _, path := range paths {
+			watched[filepath.Clean(path)] = true
+		}
+		opts.appStatus.AddWatchedDirs(len(watched))
+		defer func() { opts.appStatus.AddWatchedDirs(-len(watched)) }()
+
+		grp, ctx := errgroup.WithContext(ctx)
+		all := make(chan string)
+		grp.Go(func() error {
+			log.WithField("path", folder).Debug("Watching changes")
+			return errors.Trace(watch.Files(ctx, all, paths...))
+		})
+		grp.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
 					return nil
+				case change := <-all:
+					dir := filepath.Clean(change)
+					info, err := os.Stat(dir)
+					switch {
+					case err == nil && info.IsDir() && !watched[dir] && !ignoredFolder(opts, dir):
+						// The new folder may have been created with children already, like
+						// when copying or scaffolding a package.
+						walked, err := walkFolders(opts, dir, nil)
+						if err != nil {
+							return errors.Trace(err)
+						}
+						var newPaths []string
+						for _, path := range walked {
+							if !watched[filepath.Clean(path)] {
+								watched[filepath.Clean(path)] = true
+								newPaths = append(newPaths, path)
+							}
+						}
+						if len(newPaths) > 0 {
+							opts.appStatus.AddWatchedDirs(len(newPaths))
+							log.WithField("path", dir).Debug("Watching changes of the new folder")
+							grp.Go(func() error {
+								return errors.Trace(watch.Files(ctx, all, newPaths...))
+							})
+						}
+
+					case os.IsNotExist(err) && watched[dir]:
+						// The system stops watching the removed folders by itself.
+						delete(watched, dir)
+						opts.appStatus.AddWatchedDirs(-1)
+					}
+
+					select {
+					case <-ctx.Done():
+						return nil
+					case changes <- change:
+					}
 				}
-				return errors.Trace(err)
 			}
-			if !info.IsDir() {
+		})
+		return errors.Trace(grp.Wait())
+	}
+}
+
+// walkFolders returns the folders of the tree that should be watched. If files is
+// not nil it also saves the state of the files inside them.
+func walkFolders(opts watchOptions, folder string, files map[string]fileState) ([]string, error) {
+	var paths []string
+
+	// Real paths of the walked folders, to avoid walking them twice or looping
+	// forever when a symlink points to one of its parents.
+	visited := make(map[string]bool)
+
+	var walkFn filepath.WalkFunc
+	walkFn = func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
 				return nil
 			}
-
-			// Ignore default and custom folders.
-			if slices.Contains(defaultIgnoreFolders, filepath.Base(path)) {
-				return filepath.SkipDir
+			return errors.Trace(err)
+		}
+		if opts.followSymlinks && info.Mode()&os.ModeSymlink != 0 && !ignoredFolder(opts, path) {
+			// Broken symlinks are ignored.
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return nil
+			}
+			if targetInfo, err := os.Stat(target); err == nil && targetInfo.IsDir() {
+				return errors.Trace(filepath.Walk(target, walkFn))
 			}
-			for _, ig := range ignore {
-				if strings.HasPrefix(path, ig) {
+		}
+		if !info.IsDir() {
+			if files != nil && (len(opts.include) == 0 || matchesInclude(opts.include, filepath.Dir(path))) {
+				files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		}
+
+		if ignoredFolder(opts, path) {
+			return filepath.SkipDir
+		}
+		if opts.followSymlinks {
+			if real, err := filepath.EvalSymlinks(path); err == nil {
+				if visited[real] {
 					return filepath.SkipDir
 				}
+				visited[real] = true
 			}
+		}
 
-			paths = append(paths, path)
-
+		// Keep walking the tree even if the folder is not included, some of its children may be.
+		if len(opts.include) > 0 && !matchesInclude(opts.include, path) {
 			return nil
 		}
-		if err := filepath.Walk(folder, walkFn); err != nil {
-			return errors.Trace(err)
+
+		paths = append(paths, path)
+		if opts.maxDirs > 0 && len(paths) > opts.maxDirs {
+			return errors.Errorf("too many folders to watch in %s, more than %d: use a narrower --watch or --include, --ignore the big folders or increase --max-watched-dirs", folder, opts.maxDirs)
+		}
+
+		return nil
+	}
+	if err := filepath.Walk(folder, walkFn); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return paths, nil
+}
+
+// ignoredFolder reports if the folder is one of the default or custom ignored folders,
+// or one ignored by the .gitignore files.
+func ignoredFolder(opts watchOptions, path string) bool {
+	if slices.Contains(defaultIgnoreFolders, filepath.Base(path)) {
+		return true
+	}
+	if opts.gitignore.Ignored(path) {
+		return true
+	}
+	for _, ig := range opts.ignore {
+		if matchesIgnore(ig, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesIgnore reports if the folder is the ignored one or is inside it. An ignored
+// name without separators matches the folders with that name at any depth. Paths
+// like ./build only match the folder relative to the working directory.
+func matchesIgnore(ignore, path string) bool {
+	if name := strings.TrimSuffix(filepath.ToSlash(ignore), "/"); !strings.Contains(name, "/") {
+		return filepath.Base(path) == name
+	}
+
+	absIgnore, err := filepath.Abs(ignore)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return absPath == absIgnore || strings.HasPrefix(absPath, absIgnore+string(filepath.Separator))
+}
+
+// watchRestartFiles watches the folders containing the files. Editors usually replace
+// the file when saving it, so watching the file itself would stop detecting changes.
+func watchRestartFiles(ctx context.Context, changes chan string, files []string) func() error {
+	return func() error {
+		var paths []string
+		for _, file := range files {
+			if dir := filepath.Dir(file); !slices.Contains(paths, dir) {
+				paths = append(paths, dir)
+			}
 		}
 
-		log.WithField("path", folder).Debug("Watching changes")
+		log.WithField("files", files).Debug("Watching changes")
 		return errors.Trace(watch.Files(ctx, changes, paths...))
 	}
 }
 
-func receiveWatchChanges(ctx context.Context, changes chan string, restartExts []string, rebuild, restart chan empty) func() error {
+// isRestartFile reports if the changed path is one of the files that restart the app.
+func isRestartFile(restartFiles []string, change string) bool {
+	if len(restartFiles) == 0 {
+		return false
+	}
+	abs, err := filepath.Abs(change)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(restartFiles, abs)
+}
+
+// symlinkRepointed reports if the path is a symlink whose target is different from
+// the last time it changed.
+func symlinkRepointed(symlinks map[string]string, path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		delete(symlinks, path)
+		return false
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return false
+	}
+	if prev, ok := symlinks[path]; ok && prev == target {
+		return false
+	}
+	symlinks[path] = target
+	return true
+}
+
+// findGitDir returns the .git folder of the repository of the working directory,
+// or an empty string if there is none.
+func findGitDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil && info.IsDir() {
+			return filepath.Join(dir, ".git")
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// isGitOperation reports if the change is a file that git writes when it modifies
+// the working tree, like switching branches or rebasing.
+func isGitOperation(change string) bool {
+	if filepath.Base(filepath.Dir(change)) != ".git" {
+		return false
+	}
+	switch filepath.Base(change) {
+	case "HEAD", "HEAD.lock", "index", "index.lock", "ORIG_HEAD":
+		return true
+	}
+	return false
+}
+
+// isGenerated reports if the file is the output of the generate step. Patterns can
+// match the folder, any of its parents or the name of the file.
+func isGenerated(generated []string, path string) bool {
+	for _, pattern := range generated {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return matchesInclude(generated, path)
+}
+
+// isRebuildFile reports if the changed path is a Go file or one of the extensions
+// that rebuild the app.
+func isRebuildFile(opts runOptions, change string) bool {
+	return filepath.Ext(change) == ".go" || slices.Contains(opts.rebuildExts, filepath.Ext(change))
+}
+
+// isSchemaFile reports if the changed path is an API schema inside one of the
+// schema folders.
+func isSchemaFile(opts runOptions, change string) bool {
+	if len(opts.schemaDirs) == 0 || !slices.Contains(opts.schemaExts, filepath.Ext(change)) {
+		return false
+	}
+	abs, err := filepath.Abs(change)
+	if err != nil {
+		return false
+	}
+	for _, dir := range opts.schemaDirs {
+		if strings.HasPrefix(abs, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesInclude reports if the folder or any of its parents match one of the patterns.
+func matchesInclude(include []string, path string) bool {
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		for _, pattern := range include {
+			if ok, _ := filepath.Match(filepath.Clean(pattern), dir); ok {
+				return true
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
+
+func receiveWatchChanges(ctx context.Context, changes chan string, opts runOptions, trig triggers) func() error {
 	return func() error {
 		// Batch changes with a short timer to avoid concurrency issues with atomic saving.
 		// Also depending on the changed file we need a build or only to restart the app.
-		var buildPending bool
+		var buildPending, upgradePending, generatePending, signaturePending bool
+
+		// The binary changed without building it, the process cannot reload in place.
+		var restartPending bool
 		var waitNextChange *time.Timer
+		batch := opts.debounce
+		if opts.idle > 0 {
+			batch = opts.idle
+		}
+
+		// Git operations change lots of files, wait until they finish.
+		var gitUntil time.Time
+
+		resetTimer := func() {
+			wait := batch
+			if remaining := time.Until(gitUntil); remaining > wait {
+				wait = remaining
+			}
+			if waitNextChange == nil {
+				waitNextChange = time.NewTimer(wait)
+			} else {
+				if !waitNextChange.Stop() {
+					<-waitNextChange.C
+				}
+				waitNextChange.Reset(wait)
+			}
+		}
+
+		// Changes right after the app starts are usually caused by the app itself.
+		var ignoreUntil time.Time
+
+		var report *changesReport
+		if opts.countChanges {
+			report = newChangesReport()
+		}
+
+		// Last known target of the symlinks that changed.
+		symlinks := make(map[string]string)
+
+		// Commands of --on-change to run when the batch finishes.
+		var changeCommands []string
+
+		// Files of the current batch. Editors send several events for the same file
+		// when saving it, only the first one of the batch is taken into account.
+		batched := make(map[string]bool)
+		var batchFiles []string
 
 		for {
 			var ch <-chan time.Time
@@ -112,132 +1144,722 @@ func receiveWatchChanges(ctx context.Context, changes chan string, restartExts [
 
 			select {
 			case <-ctx.Done():
+				report.Print()
 				return nil
 
+			case <-trig.started:
+				if opts.startupIgnore > 0 {
+					ignoreUntil = time.Now().Add(opts.startupIgnore)
+				}
+
 			case change := <-changes:
-				if filepath.Ext(change) == ".go" {
+				if isGitOperation(change) {
+					log.WithField("path", change).Debug("Git operation detected, waiting for it to finish")
+					gitUntil = time.Now().Add(opts.gitDebounce)
+					if waitNextChange != nil {
+						resetTimer()
+					}
+					continue
+				}
+
+				if len(opts.watchExts) > 0 && !slices.Contains(opts.watchExts, filepath.Ext(change)) && !isRestartFile(opts.restartFiles, change) {
+					log.WithField("path", change).Trace("File change outside --watch-exts, ignored")
+					continue
+				}
+
+				report.Add(change)
+
+				if time.Now().Before(ignoreUntil) {
+					log.WithField("path", change).Debug("File change detected during the startup window, ignored")
+					continue
+				}
+
+				if commands := matchChangeHooks(opts.onChange, change); len(commands) > 0 {
+					log.WithField("path", change).Debug("File change detected, run the --on-change commands")
+					for _, command := range commands {
+						if !slices.Contains(changeCommands, command) {
+							changeCommands = append(changeCommands, command)
+						}
+					}
+					resetTimer()
+				}
+
+				if batched[change] {
+					log.WithField("path", change).Trace("File change already in the batch, ignored")
+					if waitNextChange != nil {
+						resetTimer()
+					}
+					continue
+				}
+
+				if isSchemaFile(opts, change) && !opts.noBuild {
+					log.WithField("path", change).Debug("Schema change detected, generate and rebuild")
+					buildPending = true
+					generatePending = true
+				} else if slices.Contains(opts.upgradeExts, filepath.Ext(change)) {
+					log.WithField("path", change).Debug("File change detected, upgrade")
+					upgradePending = true
+				} else if isRebuildFile(opts, change) && !opts.noBuild {
 					log.WithField("path", change).Debug("File change detected, rebuild")
 					buildPending = true
-				} else if slices.Contains(restartExts, filepath.Ext(change)) {
+					if !isGenerated(opts.generated, change) {
+						if opts.signatures == nil || filepath.Ext(change) != ".go" || opts.signatures.Changed(change) {
+							generatePending = true
+							signaturePending = true
+						} else {
+							log.WithField("path", change).Debug("Only the body of the functions changed")
+						}
+					}
+				} else if isRebuildFile(opts, change) || slices.Contains(opts.restartExts, filepath.Ext(change)) || isRestartFile(opts.restartFiles, change) {
 					log.WithField("path", change).Debug("File change detected, restart")
+					if isRebuildFile(opts, change) {
+						restartPending = true
+					}
+				} else if symlinkRepointed(symlinks, change) {
+					log.WithField("path", change).Debug("Symlink target changed, restart")
 				} else {
 					log.WithField("path", change).Debug("File change detected, but no action performed")
-					continue
-				}
 
-				if waitNextChange == nil {
-					waitNextChange = time.NewTimer(50 * time.Millisecond)
-				} else {
-					if !waitNextChange.Stop() {
-						<-waitNextChange.C
+					// Any activity postpones the pending action when waiting to be idle.
+					if opts.idle > 0 && waitNextChange != nil {
+						resetTimer()
 					}
-					waitNextChange.Reset(50 * time.Millisecond)
+					continue
 				}
 
+				batched[change] = true
+				batchFiles = append(batchFiles, change)
+				resetTimer()
+
 			case <-ch:
 				waitNextChange = nil
+				log.WithField("files", len(batched)).Debug("Batch of file changes finished")
 
-				if buildPending {
-					select {
-					case rebuild <- empty{}:
-					default:
-					}
-					buildPending = false
-				} else {
+				// The commands run in the background without stopping the app.
+				for _, command := range changeCommands {
+					go runChangeHook(ctx, command, opts)
+				}
+				changeCommands = nil
+
+				// Only the --on-change commands were pending.
+				if len(batchFiles) == 0 {
+					continue
+				}
+
+				// A full rebuild has precedence over upgrading the running process.
+				switch {
+				case buildPending:
 					select {
-					case restart <- empty{}:
+					case trig.rebuild <- buildRequest{generate: generatePending, signature: signaturePending, files: batchFiles}:
 					default:
 					}
+				case upgradePending:
+					opts.cycles.Status(logEvent("change", log.Fields{"files": batchFiles}), "upgrade (%s)", describeFiles(batchFiles))
+					send(trig.upgrade)
+				case opts.reloadSignal != nil && !restartPending:
+					opts.cycles.Status(logEvent("change", log.Fields{"files": batchFiles}), "reload (%s)", describeFiles(batchFiles))
+					send(trig.reload)
+				default:
+					opts.cycles.Status(logEvent("change", log.Fields{"files": batchFiles}), "restart (%s)", describeFiles(batchFiles))
+					send(trig.restart)
 				}
+				batched = make(map[string]bool)
+				batchFiles = nil
+				buildPending = false
+				upgradePending = false
+				restartPending = false
+				generatePending = false
+				signaturePending = false
 			}
 		}
 	}
 }
 
+// describeFiles returns the number and the names of the changed files for the
+// status lines, like "2 files: main.go, routes.go".
+func describeFiles(files []string) string {
+	const maxNames = 5
+	var names []string
+	for i, file := range files {
+		if i == maxNames {
+			names = append(names, "...")
+			break
+		}
+		names = append(names, filepath.Base(file))
+	}
+	if len(files) == 1 {
+		return "1 file: " + names[0]
+	}
+	return fmt.Sprintf("%d files: %s", len(files), strings.Join(names, ", "))
+}
+
+// prependPath returns the environment with the folders at the start of the PATH.
+func prependPath(env []string, dirs []string) []string {
+	if len(dirs) == 0 {
+		return env
+	}
+
+	path := strings.Join(dirs, string(os.PathListSeparator))
+	result := make([]string, 0, len(env)+1)
+	for _, v := range env {
+		if name, value, ok := strings.Cut(v, "="); ok && strings.EqualFold(name, "PATH") {
+			path += string(os.PathListSeparator) + value
+			continue
+		}
+		result = append(result, v)
+	}
+	return append(result, "PATH="+path)
+}
+
+// buildEnv returns the environment of the build and the generate step, with the
+// --build-path folders and the variables of appEnv.
+func buildEnv(opts runOptions) []string {
+	return append(prependPath(os.Environ(), opts.buildPath), appEnv(opts)...)
+}
+
+// appEnv returns the variables of --env-file and --env, in that order so the flags
+// take precedence.
+func appEnv(opts runOptions) []string {
+	return append(append([]string{}, opts.envFile.Vars()...), opts.env...)
+}
+
+// waitSystemLoad blocks while the system load average is above max. It returns
+// false if the context is cancelled while waiting.
+func waitSystemLoad(ctx context.Context, max float64) bool {
+	if max <= 0 {
+		return true
+	}
+
+	var logged bool
+	for {
+		load, ok := systemLoad()
+		if !ok || load <= max {
+			return true
+		}
+		if !logged {
+			log.WithFields(log.Fields{
+				"load": load,
+				"max":  max,
+			}).Info(status("waiting for the system load to drop..."))
+			logged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
 var errBuildFailed = errors.New("reloader: build failed")
 
-func buildApp(ctx context.Context, app string, restart chan empty) error {
-	log.Info(">>> build...")
+// buildError is returned when the build command fails and keeps its output
+// to report it elsewhere.
+type buildError struct {
+	output []byte
+}
+
+func (err *buildError) Error() string {
+	return errBuildFailed.Error()
+}
+
+func (err *buildError) Is(target error) bool {
+	return target == errBuildFailed
+}
+
+// buildApp builds the app. The changed files that caused the build are shown in
+// the logs if there are any.
+func buildApp(ctx context.Context, app string, opts runOptions, files []string) error {
+	if len(files) > 0 {
+		opts.cycles.Status(logEvent("build_start", log.Fields{"path": app, "files": files}), "build (%s)...", describeFiles(files))
+	} else {
+		opts.cycles.Status(logEvent("build_start", log.Fields{"path": app}), "build...")
+	}
 
-	cmd := exec.CommandContext(ctx, "go", "install", app)
+	var output bytes.Buffer
+	command := []string{"go", "install"}
+	if opts.output != "" {
+		command = []string{"go", "build", "-o", opts.output}
+	}
+	if opts.tags != "" {
+		command = append(command, "-tags", opts.tags)
+	}
+	if opts.race {
+		command = append(command, "-race")
+	}
+	command = append(command, opts.buildFlags...)
+	command = append(command, app)
+	if len(opts.buildCmd) > 0 {
+		command = opts.buildCmd
+	}
+	var cmd *exec.Cmd
+	if opts.remote != nil {
+		if env := appEnv(opts); len(env) > 0 {
+			command = append(append([]string{"env"}, env...), command...)
+		}
+		cmd = opts.remote.Command(ctx, command[0], command[1:]...)
+	} else {
+		cmd = exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Env = buildEnv(opts)
+	}
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if opts.logBuild {
+		env := appEnv(opts)
+		if len(opts.buildPath) > 0 && opts.remote == nil {
+			env = append([]string{"PATH=" + strings.Join(opts.buildPath, string(os.PathListSeparator)) + string(os.PathListSeparator) + "$PATH"}, env...)
+		}
+		log.WithFields(log.Fields{
+			"command": strings.Join(cmd.Args, " "),
+			"env":     env,
+		}).Info(status("build command"))
+	}
+
+	stderr := newPrefixWriter(os.Stderr, opts.buildPrefix)
+
+	// The output is buffered if we need to know the result before showing it.
+	buffered := opts.quietBuild || opts.buildFilter != nil
+	if buffered {
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+	} else {
+		cmd.Stdout = newPrefixWriter(os.Stdout, opts.buildPrefix)
+		cmd.Stderr = io.MultiWriter(stderr, &output)
+	}
+	start := time.Now()
 	if err := cmd.Run(); err != nil {
 		if _, ok := err.(*exec.ExitError); ok {
-			log.Error(">>> build command failed!")
-			return errors.Trace(errBuildFailed)
+			// The build was cancelled because a newer change superseded it.
+			if ctx.Err() != nil {
+				return errors.Trace(ctx.Err())
+			}
+			if buffered {
+				if _, err := stderr.Write(output.Bytes()); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			logEvent("build_failed", log.Fields{"path": app, "duration_ms": time.Since(start).Milliseconds()}).Error(status("build command failed!"))
+			if opts.output == "" && len(opts.buildCmd) == 0 && opts.remote == nil && cannotInstall(output.Bytes()) {
+				log.WithField("path", filepath.Join(build.Default.GOPATH, "bin")).Error("Cannot write the binary in GOPATH/bin, use --output to build it in another folder")
+			}
+			return errors.Trace(&buildError{output: output.Bytes()})
 		}
 
 		return errors.Trace(err)
 	}
 
-	select {
-	case restart <- empty{}:
-	default:
+	if buffered && !opts.quietBuild {
+		if _, err := stderr.Write(filterLines(output.Bytes(), opts.buildFilter)); err != nil {
+			return errors.Trace(err)
+		}
 	}
 
+	elapsed := time.Since(start)
+	opts.cycles.Status(logEvent("build_end", log.Fields{"path": app, "duration_ms": elapsed.Milliseconds()}), "build done in %s", elapsed.Round(100*time.Millisecond))
+
 	return nil
 }
 
-func appManager(ctx context.Context, args []string, shouldRestart bool, rebuild, restart chan empty) func() error {
+// cannotInstall reports if the build failed because GOPATH/bin is not writable,
+// instead of a compilation error.
+func cannotInstall(output []byte) bool {
+	if !bytes.Contains(output, []byte(filepath.Join(build.Default.GOPATH, "bin"))) {
+		return false
+	}
+	return bytes.Contains(output, []byte("permission denied")) || bytes.Contains(output, []byte("read-only file system"))
+}
+
+// filterLines removes the lines of the output that match the expression.
+func filterLines(output []byte, re *regexp.Regexp) []byte {
+	var result []byte
+	for _, line := range bytes.SplitAfter(output, []byte("\n")) {
+		if len(line) > 0 && !re.Match(bytes.TrimRight(line, "\r\n")) {
+			result = append(result, line...)
+		}
+	}
+	return result
+}
+
+// runBuild runs the whole build of the app: the generate command, the build hooks,
+// the sync of --ssh-sync and the build itself, reporting the result.
+func runBuild(ctx context.Context, app string, opts runOptions, generate bool, files []string) error {
+	if opts.noBuild {
+		return nil
+	}
+
+	if !waitSystemLoad(ctx, opts.maxLoad) {
+		return errors.Trace(ctx.Err())
+	}
+
+	opts.appStatus.BuildStarted()
+	opts.webhook.Send("build-start", true)
+	opts.cycles.Begin(true)
+	start := time.Now()
+	var err error
+	if generate {
+		err = runHookWith(ctx, "generate", opts.generate, os.Stdin, buildEnv(opts))
+		if errors.Is(err, errHookFailed) {
+			err = errors.Trace(errBuildFailed)
+		}
+	}
+	if err == nil {
+		err = runHookWith(ctx, "pre build", opts.preBuild, os.Stdin, buildEnv(opts))
+		if errors.Is(err, errHookFailed) {
+			err = errors.Trace(errBuildFailed)
+		}
+	}
+	if err == nil && opts.remote != nil {
+		err = runHook(ctx, "ssh sync", opts.sshSync)
+		if errors.Is(err, errHookFailed) {
+			err = errors.Trace(errBuildFailed)
+		}
+	}
+	if err == nil {
+		err = buildApp(ctx, app, opts, files)
+	}
+	if err == nil {
+		err = runHookWith(ctx, "post build", opts.postBuild, os.Stdin, buildEnv(opts))
+		if errors.Is(err, errHookFailed) {
+			err = errors.Trace(errBuildFailed)
+		}
+	}
+	if err == nil || errors.Is(err, errBuildFailed) {
+		opts.appStatus.BuildFinished(time.Since(start), err)
+		if err == nil {
+			opts.webhook.Send("build-success", true)
+		} else {
+			opts.webhook.Send("build-failure", false)
+		}
+		notifyBuild(ctx, opts, err)
+	}
+	if errors.Is(err, errBuildFailed) {
+		opts.cycles.BuildFailed()
+	}
+	var berr *buildError
+	if errors.As(err, &berr) {
+		opts.proxy.BuildFailed(berr.output)
+	} else if err == nil {
+		opts.proxy.BuildSucceeded()
+	}
+	return err
+}
+
+func appManager(ctx context.Context, args []string, opts runOptions, trig triggers) func() error {
 	return func() error {
-		// Build the application for the first time when starting up.
-		if err := buildApp(ctx, args[0], restart); err != nil && !errors.Is(err, errBuildFailed) {
-			return errors.Trace(err)
+		// build can run in the background while the process keeps running, it should
+		// not modify the state of the manager.
+		build := func(ctx context.Context, generate bool, files []string) error {
+			return runBuild(ctx, args[0], opts, generate, files)
+		}
+
+		var built bool
+		buildAndReport := func(generate bool, files []string) error {
+			err := build(ctx, generate, files)
+			if err == nil {
+				built = true
+			}
+			return err
+		}
+
+		// Only the result of the last build started in the background is used, the
+		// previous ones are cancelled when a newer change arrives.
+		prebuilt := make(chan prebuildResult)
+		var prebuildID int
+		var inflight *buildRequest
+		cancelPrebuild := func() {}
+		defer func() { cancelPrebuild() }()
+		supersede := func(req buildRequest) buildRequest {
+			if inflight != nil {
+				req.generate = req.generate || inflight.generate
+				req.signature = req.signature || inflight.signature
+				req.files = append(slices.Clone(inflight.files), req.files...)
+			}
+			cancelPrebuild()
+			prebuildID++
+			inflight = nil
+			return req
 		}
 
 		var cmd *exec.Cmd
 		runerr := make(chan error, 1)
-		secs := 1 * time.Second
+		secs := opts.restartDelay
+		var generation int
+
+		// Consecutive exits of the process shortly after starting it.
+		var failures int
+		var startedAt time.Time
+
+		// sendSignal sends the signal to the running process, local or remote.
+		sendSignal := func(sig os.Signal) error {
+			var err error
+			if opts.remoteRun {
+				err = opts.remote.Signal(sig)
+			} else {
+				err = cmd.Process.Signal(sig)
+			}
+			if err != nil && !errors.Is(err, os.ErrProcessDone) {
+				return errors.Trace(err)
+			}
+			return nil
+		}
+
+		// restartBuilt restarts the app with a successful build of the request,
+		// resetting the restart timer and the failures.
+		restartBuilt := func(req buildRequest) error {
+			secs = opts.restartDelay
+			failures = 0
+
+			if req.signature {
+				if err := runHook(ctx, "on signature change", opts.onSignature); err != nil && !errors.Is(err, errHookFailed) {
+					return errors.Trace(err)
+				}
+			}
+
+			send(trig.restart)
+			return nil
+		}
+
+		// Cancels the readiness check of the current process when it stops.
+		cancelReady := func() {}
+		defer func() { cancelReady() }()
+
+		// Wait for the process to stop gracefully when reloader exits.
+		defer func() {
+			if cmd != nil && ctx.Err() != nil {
+				log.Info(status("stop..."))
+				<-runerr
+			}
+		}()
+
+		if opts.attach > 0 {
+			var err error
+			cmd, err = attachProcess(ctx, runerr, opts.attach)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		} else if opts.noInitialBuild {
+			built = true
+			send(trig.restart)
+		} else {
+			// Build the application for the first time when starting up.
+			err := buildAndReport(true, nil)
+			switch {
+			case err == nil:
+				send(trig.restart)
+			case errors.Is(err, errBuildFailed) && !opts.failOnBuild:
+				// Wait for changes that fix the build.
+				opts.start.Done()
+			case ctx.Err() != nil:
+				return nil
+			default:
+				return errors.Trace(err)
+			}
+		}
 
 		for {
 			select {
 			case <-ctx.Done():
 				return nil
 
-			case <-rebuild:
-				if err := stopProcess(ctx, cmd, runerr); err != nil {
+			case req := <-trig.rebuild:
+				req = supersede(req)
+				if opts.prebuild && cmd != nil {
+					id := prebuildID
+					inflight = &req
+					bctx, cancel := context.WithCancel(ctx)
+					cancelPrebuild = cancel
+					go func() {
+						err := build(bctx, req.generate, req.files)
+						select {
+						case prebuilt <- prebuildResult{id: id, req: req, err: err}:
+						case <-ctx.Done():
+						}
+					}()
+					continue
+				}
+
+				if cmd != nil {
+					if ok, err := runPreRestart(ctx, opts); err != nil {
+						return errors.Trace(err)
+					} else if !ok {
+						continue
+					}
+				}
+
+				opts.start.Begin()
+				cancelReady()
+				if err := stopProcess(ctx, cmd, runerr, opts); err != nil {
 					return errors.Trace(err)
 				}
 				cmd = nil
 
-				if err := buildApp(ctx, args[0], restart); err != nil {
+				if err := buildAndReport(req.generate, req.files); err != nil {
 					if errors.Is(err, errBuildFailed) {
+						opts.start.Done()
 						continue
 					}
+					if ctx.Err() != nil {
+						return nil
+					}
 
 					return errors.Trace(err)
 				}
 
-				// Reset the restart timer after a successful build.
-				secs = 1 * time.Second
+				if err := restartBuilt(req); err != nil {
+					return errors.Trace(err)
+				}
 
-				select {
-				case restart <- empty{}:
-				default:
+			case res := <-prebuilt:
+				if res.id != prebuildID {
+					continue
+				}
+				inflight = nil
+				if res.err != nil {
+					// The current process keeps running until a change fixes the build.
+					if errors.Is(res.err, errBuildFailed) {
+						continue
+					}
+					if ctx.Err() != nil {
+						return nil
+					}
+
+					return errors.Trace(res.err)
+				}
+				built = true
+
+				if err := restartBuilt(res.req); err != nil {
+					return errors.Trace(err)
+				}
+
+			case <-trig.upgrade:
+				if err := buildAndReport(true, nil); err != nil {
+					if errors.Is(err, errBuildFailed) {
+						continue
+					}
+					if ctx.Err() != nil {
+						return nil
+					}
+
+					return errors.Trace(err)
+				}
+
+				// Start the new binary if there is no process that could upgrade itself.
+				if cmd == nil {
+					send(trig.restart)
+					continue
+				}
+				log.WithField("signal", opts.upgradeSignal.String()).Info(status("upgrade..."))
+				if err := sendSignal(opts.upgradeSignal); err != nil {
+					return errors.Trace(err)
+				}
+
+			case <-trig.reload:
+				if cmd == nil {
+					send(trig.restart)
+					continue
+				}
+				log.WithField("signal", opts.reloadSignal.String()).Info(status("reload..."))
+				if err := sendSignal(opts.reloadSignal); err != nil {
+					return errors.Trace(err)
+				}
+
+			case <-trig.restart:
+				// The attached process may not match the installed binary, build it before
+				// replacing the process.
+				if !built {
+					if err := buildAndReport(true, nil); err != nil {
+						if errors.Is(err, errBuildFailed) {
+							opts.start.Done()
+							continue
+						}
+						if ctx.Err() != nil {
+							return nil
+						}
+						return errors.Trace(err)
+					}
+					send(trig.restart)
+					continue
+				}
+
+				if cmd != nil {
+					if ok, err := runPreRestart(ctx, opts); err != nil {
+						return errors.Trace(err)
+					} else if !ok {
+						continue
+					}
 				}
 
-			case <-restart:
-				if err := stopProcess(ctx, cmd, runerr); err != nil {
+				opts.start.Begin()
+				opts.cycles.Begin(false)
+				cancelReady()
+				if err := stopProcess(ctx, cmd, runerr, opts); err != nil {
 					return errors.Trace(err)
 				}
+				cmd = nil
+
+				// Several apps restarting at the same time start one after another.
+				if !waitStagger(ctx, opts.prevStart, opts.stagger) {
+					return nil
+				}
 
-				log.Info(">>> run...")
+				opts.cycles.Status(logEvent("restart", log.Fields{"path": args[0]}), "run...")
+				generation++
 				var err error
-				cmd, err = startProcess(ctx, runerr, args)
+				cmd, err = startProcess(ctx, runerr, args, opts, trig.restart, generation)
 				if err != nil {
+					// The binary skipped by --no-initial-build may not exist yet.
+					if opts.noInitialBuild && !opts.noBuild && generation == 1 && errors.Is(err, os.ErrNotExist) {
+						log.WithField("error", err.Error()).Warning(status("cannot run the installed binary, building it first"))
+						generation--
+						built = false
+						send(trig.restart)
+						continue
+					}
 					return errors.Trace(err)
 				}
+				startedAt = time.Now()
+				opts.appStatus.ProcessStarted()
+				opts.webhook.Send("restart", true)
+				opts.cycles.Started()
+				opts.start.Done()
+
+				send(trig.started)
+
+				cancelReady = notifyReady(ctx, opts)
 
 			case appErr := <-runerr:
+				cancelReady()
 				cmd = nil
+				code := exitCode(appErr)
+				if opts.task {
+					appErr = taskError(appErr, code, opts.successCodes)
+				}
+				opts.appStatus.ProcessExited(appErr, code)
+
+				failed := "command failed"
+				if code > 0 {
+					failed = fmt.Sprintf("command failed with exit code %d", code)
+				}
+				exitFields := log.Fields{"path": args[0], "exit_code": code}
+
+				if opts.restart && (appErr != nil || opts.restartOnSuccess) {
+					if time.Since(startedAt) >= stableRunTime {
+						failures = 0
+					}
+					failures++
+					if opts.maxRestarts > 0 && failures > opts.maxRestarts {
+						logger := logEvent("app_failed", exitFields)
+						if appErr != nil {
+							logger = logger.WithField("error", appErr.Error())
+						}
+						logger.Error(status("command stopped %d times in a row, waiting for changes to restart it", failures))
+						continue
+					}
 
-				if shouldRestart {
 					if appErr != nil {
-						log.WithField("error", appErr.Error()).Errorf(">>> command failed, restarting in %s", secs)
+						logEvent("app_failed", exitFields).WithField("error", appErr.Error()).Error(status("%s, restarting in %s", failed, secs))
 					} else {
-						log.Errorf(">>> command exited, restarting in %s", secs)
+						logEvent("app_exited", exitFields).Error(status("command exited, restarting in %s", secs))
 					}
 
 					// Wait a little bit before restarting the failing process.
@@ -246,16 +1868,26 @@ func appManager(ctx context.Context, args []string, shouldRestart bool, rebuild,
 						return nil
 					case <-time.After(secs):
 					}
-					secs = secs * 2
-					if secs > 8*time.Second {
-						secs = 8 * time.Second
+					secs = time.Duration(float64(secs) * opts.restartFactor)
+					if secs > opts.restartMaxDelay {
+						secs = opts.restartMaxDelay
 					}
 
 					// Run application again.
-					restart <- empty{}
+					send(trig.restart)
+				} else if opts.task {
+					if appErr != nil {
+						opts.webhook.Send("task-failure", false)
+						logEvent("task_failed", exitFields).WithField("error", appErr.Error()).Error(status("task failed with exit code %d, waiting for changes", code))
+					} else {
+						opts.webhook.Send("task-success", true)
+						logEvent("task_done", exitFields).Info(status("task done with exit code %d, waiting for changes", code))
+					}
 				} else {
 					if appErr != nil {
-						log.WithField("error", appErr.Error()).Errorf(">>> command failed")
+						logEvent("app_failed", exitFields).WithField("error", appErr.Error()).Error(status(failed))
+					} else if opts.restart {
+						logEvent("app_exited", exitFields).Info(status("command finished, waiting for changes"))
 					}
 				}
 			}
@@ -263,34 +1895,212 @@ func appManager(ctx context.Context, args []string, shouldRestart bool, rebuild,
 	}
 }
 
-func startProcess(ctx context.Context, runerr chan error, args []string) (*exec.Cmd, error) {
-	name := filepath.Base(args[0])
-	if args[0] == "." {
-		wd, err := os.Getwd()
-		if err != nil {
-			return nil, errors.Trace(err)
+// runOnce builds the app and runs it until it exits, without watching for changes.
+// It returns the exit code of the app.
+func runOnce(ctx context.Context, args []string, opts runOptions) (int, error) {
+	if err := runBuild(ctx, args[0], opts, true, nil); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	log.Info(status("run..."))
+	runerr := make(chan error, 1)
+	if _, err := startProcess(ctx, runerr, args, opts, make(chan empty, 1), 1); err != nil {
+		return 0, errors.Trace(err)
+	}
+	appErr := <-runerr
+	code := exitCode(appErr)
+	if code < 0 {
+		return 0, errors.Trace(appErr)
+	}
+	if opts.task && taskError(appErr, code, opts.successCodes) == nil {
+		logEvent("task_done", log.Fields{"path": args[0], "exit_code": code}).Info(status("task done with exit code %d", code))
+		return 0, nil
+	}
+	logEvent("app_exited", log.Fields{"path": args[0], "exit_code": code}).Info(status("command exited with code %d", code))
+	if opts.task && code == 0 {
+		return 1, nil
+	}
+	return code, nil
+}
+
+// taskError returns the error of a task from its exit code. The codes of
+// --success-codes are not errors, even if the process returned one.
+func taskError(err error, code int, successCodes []int) error {
+	if code >= 0 && slices.Contains(successCodes, code) {
+		return nil
+	}
+	if err == nil {
+		return errors.Errorf("exit code %d is not a success code", code)
+	}
+	return err
+}
+
+// exitCode returns the exit code of the process from the error of Wait. A process
+// killed by a signal returns 128 plus the number of the signal like the shells do,
+// for example 137 for SIGKILL. It is -1 if the code is unknown.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// stableRunTime is the time the process should run to reset the count of
+// consecutive failures.
+const stableRunTime = 10 * time.Second
+
+// startProcess runs the installed binary, the one of --bin or the --shell command.
+// The generation counts the processes started since reloader itself started,
+// beginning at 1.
+func startProcess(ctx context.Context, runerr chan error, args []string, opts runOptions, restart chan empty, generation int) (*exec.Cmd, error) {
+	if opts.remoteRun {
+		return startRemoteProcess(ctx, runerr, args, opts, restart, generation)
+	}
+
+	var cmd *exec.Cmd
+	if opts.shell != "" {
+		cmd = shellCommand(ctx, opts.shell)
+	} else {
+		bin := opts.bin
+		if bin == "" {
+			name, err := appName(args[0])
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			bin = filepath.Join(build.Default.GOPATH, "bin", name)
+		}
+		invocation := append([]string{}, opts.wrapper...)
+		invocation = append(invocation, bin)
+		invocation = append(invocation, args[1:]...)
+		cmd = exec.CommandContext(ctx, invocation[0], invocation[1:]...)
+	}
+	configureProcess(cmd, opts)
+	// The last value of a duplicated variable is the one used.
+	cmd.Env = append(os.Environ(), appEnv(opts)...)
+	if !opts.noGenEnv {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("RELOADER_GENERATION=%d", generation))
+	}
+	release := opts.cgroup.Configure(cmd)
+	err := runProcess(cmd, runerr, opts, restart)
+	release()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	trackProcess(cmd)
+
+	return cmd, nil
+}
+
+// appName returns the name of the binary that go install builds for the package.
+func appName(pkg string) (string, error) {
+	if pkg != "." {
+		return filepath.Base(pkg), nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return filepath.Base(wd), nil
+}
+
+// startRemoteProcess runs the binary installed in the remote host of --ssh. The
+// binary of GOPATH/bin is resolved by the remote shell.
+func startRemoteProcess(ctx context.Context, runerr chan error, args []string, opts runOptions, restart chan empty, generation int) (*exec.Cmd, error) {
+	bin := shellQuote(opts.bin)
+	if opts.bin == "" {
+		name := filepath.Base(args[0])
+		if args[0] == "." {
+			name = filepath.Base(opts.remote.dir)
 		}
-		name = filepath.Base(wd)
+		bin = fmt.Sprintf(`"$(go env GOPATH)/bin/"%s`, shellQuote(name))
+	}
+	var words []string
+	if env := appEnv(opts); len(env) > 0 || !opts.noGenEnv {
+		words = append(words, "env")
+		words = append(words, env...)
 	}
-	cmd := exec.CommandContext(ctx, filepath.Join(build.Default.GOPATH, "bin", name), args[1:]...)
+	if !opts.noGenEnv {
+		words = append(words, fmt.Sprintf("RELOADER_GENERATION=%d", generation))
+	}
+	words = append(words, opts.wrapper...)
+	script := bin
+	if len(words) > 0 {
+		script = shellJoin(words) + " " + script
+	}
+	if len(args) > 1 {
+		script += " " + shellJoin(args[1:])
+	}
+
+	// The ssh client reads from the terminal, it stays in the foreground group. The
+	// remote process is signaled through its PID file instead.
+	cmd := opts.remote.Process(ctx, script)
+	remoteOpts := opts
+	remoteOpts.foreground = true
+	configureProcess(cmd, remoteOpts)
+	cmd.Cancel = func() error {
+		return opts.remote.Signal(opts.finalStopSignal)
+	}
+	if err := runProcess(cmd, runerr, opts, restart); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return cmd, nil
+}
+
+// runProcess starts the command with the output of reloader and reports when it exits.
+func runProcess(cmd *exec.Cmd, runerr chan error, opts runOptions, restart chan empty) error {
+	limiter := newOutputLimiter(opts.rateLimit)
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = limiter.Writer(newPrefixWriter(os.Stdout, opts.outputPrefix))
+	cmd.Stderr = limiter.Writer(newPrefixWriter(os.Stderr, opts.outputPrefix))
+	if opts.restartMatch != nil {
+		cmd.Stdout = newMatchWriter(cmd.Stdout, opts.restartMatch, restart)
+		cmd.Stderr = newMatchWriter(cmd.Stderr, opts.restartMatch, restart)
+	}
 	if err := cmd.Start(); err != nil {
+		return errors.Trace(err)
+	}
+
+	go func() {
+		err := cmd.Wait()
+		limiter.Flush()
+		releaseProcess(cmd)
+		runerr <- errors.Trace(err)
+	}()
+
+	return nil
+}
+
+// attachProcess adopts an already running process as if it had been started by us.
+func attachProcess(ctx context.Context, runerr chan error, pid int) (*exec.Cmd, error) {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	if !processAlive(proc) {
+		return nil, errors.Errorf("cannot attach to process %d: not running", pid)
+	}
+	log.WithField("pid", pid).Info(status("attached to the running process"))
 
 	go func() {
-		runerr <- errors.Trace(cmd.Wait())
+		runerr <- errors.Trace(waitAttached(ctx, proc))
 	}()
 
-	return cmd, nil
+	return &exec.Cmd{Process: proc}, nil
 }
 
-func stopProcess(ctx context.Context, cmd *exec.Cmd, runerr chan error) error {
+func stopProcess(ctx context.Context, cmd *exec.Cmd, runerr chan error, opts runOptions) error {
 	if cmd == nil {
 		return nil
 	}
+	sig := opts.stopSignal
 
 	logger := log.WithField("pid", cmd.Process.Pid)
 
@@ -299,8 +2109,11 @@ func stopProcess(ctx context.Context, cmd *exec.Cmd, runerr chan error) error {
 	grp, ctx := errgroup.WithContext(ctx)
 
 	grp.Go(func() error {
-		logger.Trace("Send interrupt signal")
-		return errors.Trace(cmd.Process.Signal(os.Interrupt))
+		logger.WithField("signal", sig.String()).Trace("Send stop signal")
+		if opts.remoteRun {
+			return errors.Trace(opts.remote.Signal(sig))
+		}
+		return errors.Trace(signalProcess(cmd, sig))
 	})
 
 	grp.Go(func() error {
@@ -313,8 +2126,8 @@ func stopProcess(ctx context.Context, cmd *exec.Cmd, runerr chan error) error {
 	grp.Go(func() error {
 		select {
 		case <-ctx.Done():
-		case <-time.After(3 * time.Second):
-			log.Info(">>> close process...")
+		case <-time.After(opts.stopGrace):
+			log.Info(status("close process..."))
 		}
 		return nil
 	})
@@ -324,9 +2137,9 @@ func stopProcess(ctx context.Context, cmd *exec.Cmd, runerr chan error) error {
 		case <-ctx.Done():
 			logger.Trace("Process closed before the timeout")
 			return nil
-		case <-time.After(15 * time.Second):
+		case <-time.After(opts.stopTimeout):
 			logger.Warning("Kill process after timeout")
-			return errors.Trace(cmd.Process.Kill())
+			return errors.Trace(killProcess(cmd))
 		}
 	})
 
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchesIgnore(t *testing.T) {
+	tests := []struct {
+		ignore string
+		path   string
+		want   bool
+	}{
+		{"build", "build", true},
+		{"build", "build-tools", false},
+		{"build", "cmd/build", true},
+		{"build", "cmd/build-tools", false},
+		{"build/", "cmd/build", true},
+		{"./build", "build", true},
+		{"./build", "build/assets", true},
+		{"./build", "build-tools", false},
+		{"./build", "cmd/build", false},
+		{"cmd/build", "cmd/build", true},
+		{"cmd/build", "cmd/build/assets", true},
+		{"cmd/build", "cmd/build-tools", false},
+		{"cmd/build", "build", false},
+	}
+	for _, test := range tests {
+		if got := matchesIgnore(test.ignore, test.path); got != test.want {
+			t.Errorf("matchesIgnore(%q, %q) = %v, want %v", test.ignore, test.path, got, test.want)
+		}
+	}
+}
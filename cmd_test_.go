@@ -1,13 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"go/build"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/altipla-consulting/errors"
+	"github.com/mattn/go-shellwords"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -19,33 +30,162 @@ var cmdTest = &cobra.Command{
 }
 
 func init() {
-	var flagVerbose bool
-	var flagRun, flagTags string
+	var flagVerbose, flagOpen, flagInteractive, flagNoVet, flagWarm, flagJSON, flagCompile, flagCover, flagRace bool
+	var flagFailfast, flagBenchmem, flagChangedOnly bool
+	var flagRun, flagTags, flagCoverHTML, flagResultsJSONL, flagCompileArgs, flagCompileWrapper string
+	var flagCoverProfile, flagBench, flagBenchtime string
+	var flagWatcher string
+	var flagPollInterval, flagTimeout, flagDebounce time.Duration
+	var flagIgnore []string
 	var flagCount int64
+	var flagPkgParallel, flagStress, flagParallel int
 	cmdTest.PersistentFlags().BoolVarP(&flagVerbose, "verbose", "v", false, "Verbose run of the go tests.")
 	cmdTest.PersistentFlags().StringVarP(&flagRun, "run", "r", "", "Run only those tests and examples matching the regular expression.")
 	cmdTest.PersistentFlags().StringVarP(&flagTags, "tags", "t", "", "Tags for the go build command.")
 	cmdTest.PersistentFlags().Int64VarP(&flagCount, "count", "c", 0, "Run tests multiple times. If count is 0 it will run one time. If count is 1 it will run one time but without caching the result (standard go test behavior).")
+	cmdTest.PersistentFlags().DurationVar(&flagTimeout, "timeout", 0, "Fail the tests that run longer than this time, so a hanging test does not block the next runs. Defaults to the 10m of go test.")
+	cmdTest.PersistentFlags().StringVar(&flagBench, "bench", "", "Run the benchmarks matching the regular expression. The tests are skipped unless --run selects some of them.")
+	cmdTest.PersistentFlags().StringVar(&flagBenchtime, "benchtime", "", "Time or number of iterations of each benchmark, for example '2s' or '100x'.")
+	cmdTest.PersistentFlags().BoolVar(&flagBenchmem, "benchmem", false, "Print the memory allocations of the benchmarks.")
+	cmdTest.PersistentFlags().BoolVar(&flagFailfast, "failfast", false, "Stop the tests after the first failure.")
+	cmdTest.PersistentFlags().IntVar(&flagParallel, "parallel", 0, "Maximum number of parallel tests of each package. Defaults to GOMAXPROCS if zero.")
+	cmdTest.PersistentFlags().BoolVar(&flagRace, "race", false, "Run the tests with the race detector.")
+	cmdTest.PersistentFlags().BoolVar(&flagNoVet, "no-vet", false, "Skip the go vet checks of go test for faster runs.")
+	cmdTest.PersistentFlags().StringVar(&flagWatcher, "watcher", watcherNative, watcherUsage)
+	cmdTest.PersistentFlags().BoolVar(&flagChangedOnly, "changed-only", false, "Run only the tests of the packages with changes instead of all of them. It runs all of them if a change is outside a package.")
+	cmdTest.PersistentFlags().StringSliceVarP(&flagIgnore, "ignore", "g", nil, "Folders to ignore. A name without slashes like 'build' ignores the folders with that name at any depth.")
+	cmdTest.PersistentFlags().DurationVar(&flagDebounce, "debounce", 50*time.Millisecond, "Wait this time after a change to group it with the next ones before running the tests again.")
+	cmdTest.PersistentFlags().DurationVar(&flagPollInterval, "poll-interval", defaultPollInterval, pollIntervalUsage)
+	cmdTest.PersistentFlags().BoolVar(&flagWarm, "warm", false, "Compile the tests while starting to fill the build cache before the first run.")
+	cmdTest.PersistentFlags().BoolVarP(&flagInteractive, "interactive", "i", false, "Read commands from the standard input, like 'run TestFoo' to change the tests to run. Tests do not receive the standard input in this mode.")
+	cmdTest.PersistentFlags().IntVar(&flagPkgParallel, "pkg-parallel", 0, "Run the tests of each package in a separate process, up to this number at the same time, printing the output of each package when it finishes.")
+	cmdTest.PersistentFlags().IntVar(&flagStress, "stress", 0, "Run the tests this number of times in parallel to detect flaky tests, reporting how many runs passed.")
+	cmdTest.PersistentFlags().BoolVar(&flagJSON, "json", false, "Print the output of go test -json unchanged for external formatters. The status lines of reloader are printed to the standard error.")
+	cmdTest.PersistentFlags().StringVar(&flagResultsJSONL, "results-jsonl", "", "Append the result of every run to this file as a JSON line, with the time, the duration and the failed tests.")
+	cmdTest.PersistentFlags().BoolVar(&flagCompile, "compile", false, "Compile the test binary of the package with go test -c and run it, instead of running go test directly.")
+	cmdTest.PersistentFlags().StringVar(&flagCompileArgs, "compile-args", "", "Arguments for the compiled test binary in --compile mode, for example '-test.benchmem'.")
+	cmdTest.PersistentFlags().StringVar(&flagCompileWrapper, "compile-wrapper", "", "Command to prepend to the compiled test binary in --compile mode, for example 'dlv exec --headless --listen :2345'.")
+	cmdTest.PersistentFlags().BoolVar(&flagCover, "cover", false, "Print the coverage of every package after the tests.")
+	cmdTest.PersistentFlags().StringVar(&flagCoverProfile, "coverprofile", "", "Write the coverage profile to this path after every run, replacing the previous one, and print the total coverage.")
+	cmdTest.PersistentFlags().StringVar(&flagCoverHTML, "cover-html", "", "Write an HTML coverage report to this path after every run.")
+	cmdTest.PersistentFlags().BoolVar(&flagOpen, "open", false, "Open the HTML coverage report in the browser after the first run.")
 
 	cmdTest.RunE = func(cmd *cobra.Command, args []string) error {
+		coverage := flagCoverHTML != "" || flagCoverProfile != ""
+		if flagPkgParallel > 0 && coverage {
+			return errors.Errorf("--pkg-parallel cannot be combined with --cover-html or --coverprofile")
+		}
+		if flagStress > 0 && (flagPkgParallel > 0 || coverage) {
+			return errors.Errorf("--stress cannot be combined with --pkg-parallel, --cover-html or --coverprofile")
+		}
+		if (flagResultsJSONL != "" || flagJSON) && (flagPkgParallel > 0 || flagStress > 0) {
+			return errors.Errorf("--results-jsonl and --json cannot be combined with --pkg-parallel or --stress")
+		}
+		if flagCompile && (flagPkgParallel > 0 || flagStress > 0 || flagJSON || flagResultsJSONL != "" || coverage) {
+			return errors.Errorf("--compile cannot be combined with --pkg-parallel, --stress, --json, --results-jsonl, --cover-html or --coverprofile")
+		}
+		if flagCompile && len(args) > 1 {
+			return errors.Errorf("--compile only supports one package")
+		}
+		if flagCompile && flagChangedOnly {
+			return errors.Errorf("--compile cannot be combined with --changed-only")
+		}
+		if err := checkWatcher(flagWatcher, flagPollInterval); err != nil {
+			return errors.Trace(err)
+		}
+		if flagDebounce <= 0 {
+			return errors.Errorf("invalid --debounce %s: it should be greater than zero", flagDebounce)
+		}
+		compileArgs, err := shellwords.Parse(flagCompileArgs)
+		if err != nil {
+			return errors.Errorf("invalid --compile-args: %v", err)
+		}
+		compileWrapper, err := shellwords.Parse(flagCompileWrapper)
+		if err != nil {
+			return errors.Errorf("invalid --compile-wrapper: %v", err)
+		}
+
 		changes := make(chan string)
 		reload := make(chan bool, 1)
 
+		// go test replaces the profile in every run.
+		coverProfile := flagCoverProfile
+		if coverProfile == "" && flagCoverHTML != "" {
+			f, err := os.CreateTemp("", "reloader-cover-*.out")
+			if err != nil {
+				return errors.Trace(err)
+			}
+			coverProfile = f.Name()
+			if err := f.Close(); err != nil {
+				return errors.Trace(err)
+			}
+			defer os.Remove(coverProfile)
+		}
+		var coverOpened bool
+
 		g, ctx := errgroup.WithContext(cmd.Context())
 
+		wopts := watchOptions{
+			ignore:       flagIgnore,
+			watcher:      flagWatcher,
+			pollInterval: flagPollInterval,
+		}
 		for _, path := range args {
-			g.Go(watchFolder(ctx, changes, []string{}, path))
+			g.Go(watchFolder(ctx, changes, wopts, path))
 		}
 
+		warmed := make(chan empty)
+		if flagWarm {
+			g.Go(func() error {
+				defer close(warmed)
+				buildFlags := testBuildFlags(flagTags, flagNoVet, flagRace, flagCover || coverProfile != "")
+				return errors.Trace(warmCache(ctx, buildFlags, args))
+			})
+		} else {
+			close(warmed)
+		}
+
+		// Files changed since the last run, to run only their packages with --changed-only.
+		// The changes of other files like golden fixtures skip the test cache.
+		var changedMu sync.Mutex
+		var changedFiles []string
+		var fixtureChanged bool
+
 		g.Go(func() error {
+			// Batch the changes of the same save before running the tests.
+			var waitNextChange *time.Timer
 			for {
+				var ch <-chan time.Time
+				if waitNextChange != nil {
+					ch = waitNextChange.C
+				}
+
 				select {
 				case <-ctx.Done():
 					return nil
 
 				case change := <-changes:
 					log.WithField("path", change).Debug("File change detected")
+					changedMu.Lock()
+					if flagChangedOnly {
+						changedFiles = append(changedFiles, change)
+					}
+					if filepath.Ext(change) != ".go" {
+						fixtureChanged = true
+					}
+					changedMu.Unlock()
+
+					if waitNextChange == nil {
+						waitNextChange = time.NewTimer(flagDebounce)
+					} else {
+						if !waitNextChange.Stop() {
+							<-waitNextChange.C
+						}
+						waitNextChange.Reset(flagDebounce)
+					}
 
+				case <-ch:
+					waitNextChange = nil
 					select {
 					case reload <- true:
 					default:
@@ -54,50 +194,226 @@ func init() {
 			}
 		})
 
+		runFilter := flagRun
+		patterns := make(chan string)
+		if flagInteractive {
+			go readTestCommands(ctx, patterns)
+		}
+
 		g.Go(func() error {
 			// First test run.
-			reload <- true
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-warmed:
+			}
+			select {
+			case reload <- true:
+			default:
+			}
 
 			for {
 				select {
 				case <-ctx.Done():
 					return nil
 
+				case pattern := <-patterns:
+					runFilter = pattern
+					if runFilter == "" {
+						log.Info(status("running all tests"))
+					} else {
+						log.WithField("pattern", runFilter).Info(status("running only matching tests"))
+					}
+
+					select {
+					case reload <- true:
+					default:
+					}
+
 				case <-reload:
-					log.Info(">>> test...")
+					log.Info(status("test..."))
+
+					changedMu.Lock()
+					files := changedFiles
+					noCache := fixtureChanged
+					changedFiles = nil
+					fixtureChanged = false
+					changedMu.Unlock()
+
+					pkgs := args
+					if len(files) > 0 {
+						changed, err := changedPackages(ctx, flagTags, files)
+						if err != nil {
+							if ctx.Err() != nil {
+								return nil
+							}
+							log.WithField("error", err.Error()).Debug("Cannot resolve the changed packages, testing all of them")
+						} else {
+							pkgs = changed
+							log.WithField("packages", strings.Join(pkgs, " ")).Info(status("testing only the changed packages"))
+						}
+					}
 
 					runCmd := []string{"test"}
 					if flagVerbose {
 						runCmd = append(runCmd, "-v")
 					}
-					if flagRun != "" {
-						runCmd = append(runCmd, "-run", flagRun)
+					if runFilter != "" {
+						runCmd = append(runCmd, "-run", runFilter)
+					} else if flagBench != "" {
+						runCmd = append(runCmd, "-run", "^$")
+					}
+					if flagBench != "" {
+						runCmd = append(runCmd, "-bench", flagBench)
+					}
+					if flagBenchtime != "" {
+						runCmd = append(runCmd, "-benchtime", flagBenchtime)
+					}
+					if flagBenchmem {
+						runCmd = append(runCmd, "-benchmem")
 					}
 					if flagTags != "" {
 						runCmd = append(runCmd, "-tags", flagTags)
 					}
 					if flagCount > 0 {
 						runCmd = append(runCmd, "-count", fmt.Sprint(flagCount))
+					} else if noCache {
+						runCmd = append(runCmd, "-count", "1")
 					}
-					runCmd = append(runCmd, args...)
-					cmd := exec.CommandContext(ctx, "go", runCmd...)
-					cmd.Stdin = os.Stdin
-					cmd.Stdout = os.Stdout
-					cmd.Stderr = os.Stderr
-					if err := cmd.Run(); err != nil {
+					if flagRace {
+						runCmd = append(runCmd, "-race")
+					}
+					if flagTimeout > 0 {
+						runCmd = append(runCmd, "-timeout", flagTimeout.String())
+					}
+					if flagFailfast {
+						runCmd = append(runCmd, "-failfast")
+					}
+					if flagParallel > 0 {
+						runCmd = append(runCmd, "-parallel", fmt.Sprint(flagParallel))
+					}
+					if flagNoVet {
+						runCmd = append(runCmd, "-vet=off")
+					}
+					if flagCover {
+						runCmd = append(runCmd, "-cover")
+					}
+					if coverProfile != "" {
+						runCmd = append(runCmd, "-coverprofile", coverProfile)
+					}
+					var err error
+					switch {
+					case flagCompile:
+						buildFlags := testBuildFlags(flagTags, flagNoVet, flagRace, flagCover)
+						var testFlags []string
+						if flagVerbose {
+							testFlags = append(testFlags, "-test.v")
+						}
+						if runFilter != "" {
+							testFlags = append(testFlags, "-test.run", runFilter)
+						} else if flagBench != "" {
+							testFlags = append(testFlags, "-test.run", "^$")
+						}
+						if flagBench != "" {
+							testFlags = append(testFlags, "-test.bench", flagBench)
+						}
+						if flagBenchtime != "" {
+							testFlags = append(testFlags, "-test.benchtime", flagBenchtime)
+						}
+						if flagBenchmem {
+							testFlags = append(testFlags, "-test.benchmem")
+						}
+						if flagCount > 0 {
+							testFlags = append(testFlags, "-test.count", fmt.Sprint(flagCount))
+						}
+						if flagTimeout > 0 {
+							testFlags = append(testFlags, "-test.timeout", flagTimeout.String())
+						}
+						if flagFailfast {
+							testFlags = append(testFlags, "-test.failfast")
+						}
+						if flagParallel > 0 {
+							testFlags = append(testFlags, "-test.parallel", fmt.Sprint(flagParallel))
+						}
+						testFlags = append(testFlags, compileArgs...)
+						err = testCompiled(ctx, args[0], buildFlags, compileWrapper, testFlags)
+					case flagPkgParallel > 0:
+						err = testPackagesParallel(ctx, runCmd, pkgs, flagPkgParallel)
+					case flagStress > 0:
+						err = testStress(ctx, append(runCmd, pkgs...), flagStress)
+					default:
+						var events *testEventWriter
+						if flagJSON {
+							runCmd = append(runCmd, "-json")
+						}
+						if flagResultsJSONL != "" {
+							if !flagJSON {
+								runCmd = append(runCmd, "-json")
+							}
+							events = &testEventWriter{out: os.Stdout, verbose: flagVerbose, raw: flagJSON}
+						}
+						runCmd = append(runCmd, pkgs...)
+						cmd := exec.CommandContext(ctx, "go", runCmd...)
+						if !flagInteractive {
+							cmd.Stdin = os.Stdin
+						}
+						cmd.Stdout = os.Stdout
+						if events != nil {
+							cmd.Stdout = events
+						}
+						cmd.Stderr = os.Stderr
+						start := time.Now()
+						err = cmd.Run()
+
+						if events != nil && ctx.Err() == nil {
+							result := testRunResult{
+								Time:        start,
+								Passed:      err == nil,
+								FailedTests: events.failed,
+								DurationMs:  time.Since(start).Milliseconds(),
+							}
+							if result.FailedTests == nil {
+								result.FailedTests = []failedTest{}
+							}
+							if err := appendTestResult(flagResultsJSONL, result); err != nil {
+								return errors.Trace(err)
+							}
+						}
+					}
+					if err != nil {
 						if ctx.Err() != nil {
 							return nil
 						}
 
-						if _, ok := err.(*exec.ExitError); ok {
-							log.Error(">>> command failed!")
+						if _, ok := err.(*exec.ExitError); ok || errors.Is(err, errTestsFailed) {
+							log.Error(status("command failed!"))
 							continue
 						}
 
 						return errors.Trace(err)
 					}
 
-					log.Info(">>> waiting...")
+					if flagCoverProfile != "" {
+						total, err := coverTotal(flagCoverProfile)
+						if err != nil {
+							log.WithField("error", err.Error()).Warning("Cannot read the coverage profile")
+						} else {
+							log.WithField("path", flagCoverProfile).Info(status("total coverage %.1f%%", total))
+						}
+					}
+					if flagCoverHTML != "" {
+						if err := coverReport(ctx, coverProfile, flagCoverHTML); err != nil {
+							return errors.Trace(err)
+						}
+						if flagOpen && !coverOpened {
+							coverOpened = true
+							if err := openBrowser(flagCoverHTML); err != nil {
+								log.WithField("error", err.Error()).Warning("Cannot open the coverage report in the browser")
+							}
+						}
+					}
+
+					log.Info(status("waiting..."))
 				}
 			}
 		})
@@ -110,3 +426,340 @@ func init() {
 		return nil
 	}
 }
+
+// readTestCommands reads commands from the standard input. Only "run [pattern]" is
+// supported, that changes the tests to run or clears the filter if empty.
+func readTestCommands(ctx context.Context, patterns chan string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != "run" || len(fields) > 2 {
+			log.WithField("command", scanner.Text()).Warning("Unknown command, use 'run [pattern]'")
+			continue
+		}
+
+		var pattern string
+		if len(fields) == 2 {
+			pattern = fields[1]
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case patterns <- pattern:
+		}
+	}
+}
+
+// warmCache compiles the packages and their tests without running any of them. Errors
+// are ignored because the first run will report them.
+func warmCache(ctx context.Context, buildFlags []string, patterns []string) error {
+	log.Info(status("warming the build cache..."))
+
+	// The test binaries are built with a no-op -exec instead of running them.
+	noop := "true"
+	if runtime.GOOS == "windows" {
+		noop = "cmd /c rem"
+	}
+	cmdArgs := append([]string{"test", "-exec", noop}, buildFlags...)
+	cmd := exec.CommandContext(ctx, "go", append(cmdArgs, patterns...)...)
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok || ctx.Err() != nil {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// testBuildFlags returns the flags of go test that change how the test binaries
+// are built, so they are the same when warming the cache and running the tests.
+func testBuildFlags(tags string, noVet, race, cover bool) []string {
+	var flags []string
+	if tags != "" {
+		flags = append(flags, "-tags", tags)
+	}
+	if noVet {
+		flags = append(flags, "-vet=off")
+	}
+	if race {
+		flags = append(flags, "-race")
+	}
+	if cover {
+		flags = append(flags, "-cover")
+	}
+	return flags
+}
+
+// changedPackages returns the import paths of the packages of the changed files with
+// go list. It fails if any of the files is not inside a package.
+func changedPackages(ctx context.Context, tags string, files []string) ([]string, error) {
+	var dirs []string
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if !filepath.IsAbs(dir) && !build.IsLocalImport(dir) {
+			dir = "./" + dir
+		}
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	cmdArgs := []string{"list"}
+	if tags != "" {
+		cmdArgs = append(cmdArgs, "-tags", tags)
+	}
+	cmd := exec.CommandContext(ctx, "go", append(cmdArgs, dirs...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, errors.Errorf("go list failed: %s", bytes.TrimSpace(exitErr.Stderr))
+		}
+		return nil, errors.Trace(err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+var errTestsFailed = errors.New("reloader: tests failed")
+
+// testCompiled compiles the test binary of the package and runs it through the
+// wrapper in the folder of the package like go test does.
+func testCompiled(ctx context.Context, pkg string, buildFlags, wrapper, testFlags []string) error {
+	list := exec.CommandContext(ctx, "go", "list", "-f", "{{.Dir}}", pkg)
+	list.Stderr = os.Stderr
+	output, err := list.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return errors.Trace(errTestsFailed)
+		}
+		return errors.Trace(err)
+	}
+	dir := strings.TrimSpace(string(output))
+
+	bin := filepath.Join(os.TempDir(), "reloader-"+filepath.Base(dir)+".test")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	if err := os.Remove(bin); err != nil && !os.IsNotExist(err) {
+		return errors.Trace(err)
+	}
+	compile := exec.CommandContext(ctx, "go", append(append([]string{"test", "-c", "-o", bin}, buildFlags...), pkg)...)
+	compile.Stdout = os.Stdout
+	compile.Stderr = os.Stderr
+	if err := compile.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return errors.Trace(errTestsFailed)
+		}
+		return errors.Trace(err)
+	}
+	if _, err := os.Stat(bin); os.IsNotExist(err) {
+		log.WithField("package", pkg).Warning(status("no test files"))
+		return nil
+	}
+
+	invocation := append(append(append([]string{}, wrapper...), bin), testFlags...)
+	cmd := exec.CommandContext(ctx, invocation[0], invocation[1:]...)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return errors.Trace(errTestsFailed)
+		}
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// testPackagesParallel runs the tests of each package in its own process. The output
+// is buffered and printed when the package finishes to avoid mixing them.
+func testPackagesParallel(ctx context.Context, runCmd []string, patterns []string, parallel int) error {
+	list := exec.CommandContext(ctx, "go", append([]string{"list"}, patterns...)...)
+	list.Stderr = os.Stderr
+	output, err := list.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return errors.Trace(errTestsFailed)
+		}
+		return errors.Trace(err)
+	}
+
+	var mu sync.Mutex
+	var failed bool
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallel)
+	for _, pkg := range strings.Fields(string(output)) {
+		pkg := pkg
+		g.Go(func() error {
+			var buf bytes.Buffer
+			cmd := exec.CommandContext(ctx, "go", append(append([]string{}, runCmd...), pkg)...)
+			cmd.Stdout = &buf
+			cmd.Stderr = &buf
+			err := cmd.Run()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+				return errors.Trace(err)
+			}
+			if err != nil {
+				if _, ok := err.(*exec.ExitError); ok {
+					log.WithField("package", pkg).Error(status("package failed!"))
+					failed = true
+					return nil
+				}
+				return errors.Trace(err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return errors.Trace(err)
+	}
+	if failed {
+		return errors.Trace(errTestsFailed)
+	}
+
+	return nil
+}
+
+// testStress runs the same tests multiple times in parallel, limited by the number of
+// CPUs. Only the output of the first failed run is printed.
+func testStress(ctx context.Context, runCmd []string, runs int) error {
+	// Cached results would hide the flaky tests.
+	if !slices.Contains(runCmd, "-count") {
+		runCmd = append([]string{runCmd[0], "-count", "1"}, runCmd[1:]...)
+	}
+
+	var mu sync.Mutex
+	var passed int
+	var failure []byte
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.NumCPU())
+	for i := 0; i < runs; i++ {
+		g.Go(func() error {
+			cmd := exec.CommandContext(ctx, "go", runCmd...)
+			output, err := cmd.CombinedOutput()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if _, ok := err.(*exec.ExitError); ok {
+					if failure == nil {
+						failure = output
+					}
+					return nil
+				}
+				return errors.Trace(err)
+			}
+			passed++
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if failure != nil {
+		if _, err := os.Stdout.Write(failure); err != nil {
+			return errors.Trace(err)
+		}
+		log.WithFields(log.Fields{
+			"passed": passed,
+			"failed": runs - passed,
+		}).Error(status("stress failed!"))
+		return errors.Trace(errTestsFailed)
+	}
+	log.WithField("passed", passed).Info(status("stress passed"))
+
+	return nil
+}
+
+func coverReport(ctx context.Context, profile, output string) error {
+	log.WithField("path", output).Info(status("coverage report..."))
+
+	cmd := exec.CommandContext(ctx, "go", "tool", "cover", "-html", profile, "-o", output)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if _, ok := err.(*exec.ExitError); ok {
+			log.Error(status("coverage report failed!"))
+			return nil
+		}
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// coverTotal returns the percentage of statements covered by the tests in the
+// profile. The blocks repeated by several packages are counted once.
+func coverTotal(profile string) (float64, error) {
+	f, err := os.Open(profile)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer f.Close()
+
+	type block struct {
+		stmts   int
+		covered bool
+	}
+	blocks := make(map[string]block)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines like "pkg/file.go:10.2,12.16 3 1", after the mode line.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		var stmts, count int
+		if _, err := fmt.Sscan(fields[1], &stmts); err != nil {
+			continue
+		}
+		if _, err := fmt.Sscan(fields[2], &count); err != nil {
+			continue
+		}
+		b := blocks[fields[0]]
+		b.stmts = stmts
+		b.covered = b.covered || count > 0
+		blocks[fields[0]] = b
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	var total, covered int
+	for _, b := range blocks {
+		total += b.stmts
+		if b.covered {
+			covered += b.stmts
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(covered) * 100 / float64(total), nil
+}
+
+func openBrowser(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	return errors.Trace(cmd.Start())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/altipla-consulting/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFiles are the config files read from the working directory if there
+// is no --config flag.
+var defaultConfigFiles = []string{"reloader.yaml", ".reloader.yaml"}
+
+// bindConfig reads the flags of the command that were not set in the command line
+// or the environment from the section of the command in the config file:
+//
+//	run:
+//	  watch: [./pkg]
+//	  restart: true
+//	test:
+//	  verbose: true
+func bindConfig(cmd *cobra.Command) error {
+	path := flagConfig
+	if path == "" {
+		for _, name := range defaultConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+		if path == "" {
+			return nil
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("config file %s does not exist", path)
+		}
+		return errors.Trace(err)
+	}
+	var sections map[string]map[string]any
+	if err := yaml.Unmarshal(content, &sections); err != nil {
+		return errors.Errorf("cannot parse %s: %v", path, err)
+	}
+
+	for name, value := range sections[cmd.Name()] {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			return errors.Errorf("unknown flag %q in the %s section of %s", name, cmd.Name(), path)
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := setConfigFlag(cmd.Flags(), flag, value); err != nil {
+			return errors.Errorf("invalid %s in %s: %v", name, path, err)
+		}
+	}
+	return nil
+}
+
+// setConfigFlag sets the value of the config file in the flag. Lists set every
+// item, the same as repeating the flag in the command line.
+func setConfigFlag(flags *pflag.FlagSet, flag *pflag.Flag, value any) error {
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+	for _, item := range items {
+		if err := flags.Set(flag.Name, fmt.Sprint(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
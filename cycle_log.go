@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cycleLog reduces the status lines of every reload cycle to a single compact line
+// after a number of successful cycles. A build failure restores the verbose lines
+// until the next successful cycle. It can also clear the terminal when a cycle begins.
+type cycleLog struct {
+	mu      sync.Mutex
+	after   int
+	clear   bool
+	cycles  int
+	failed  bool
+	start   time.Time
+	rebuilt bool
+}
+
+// newCycleLog creates the log of the cycles. It is always verbose if after is zero.
+func newCycleLog(after int, clear bool) *cycleLog {
+	return &cycleLog{after: after, clear: clear}
+}
+
+func (c *cycleLog) verbose() bool {
+	return c.after == 0 || c.cycles < c.after || c.failed
+}
+
+// Status logs a status line of the cycle. It is only shown in debug mode when quiet.
+func (c *cycleLog) Status(logger *log.Entry, format string, a ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.verbose() {
+		logger.Info(status(format, a...))
+	} else {
+		logger.Debug(status(format, a...))
+	}
+}
+
+// Begin marks the start of a cycle if it was not already started by a previous step.
+func (c *cycleLog) Begin(rebuild bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.start.IsZero() {
+		c.start = time.Now()
+		if c.clear {
+			clearScreen()
+		}
+	}
+	if rebuild {
+		c.rebuilt = true
+	}
+}
+
+// BuildFailed ends the cycle and restores the verbose lines.
+func (c *cycleLog) BuildFailed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failed = true
+	c.start = time.Time{}
+	c.rebuilt = false
+}
+
+// Started ends the cycle when the process starts, printing the compact line if quiet.
+func (c *cycleLog) Started() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.verbose() {
+		elapsed := time.Since(c.start)
+		logger := logEvent("cycle", log.Fields{"duration_ms": elapsed.Milliseconds()})
+		if c.rebuilt {
+			logger.Info(status("✓ rebuilt+restarted in %s", elapsed.Round(100*time.Millisecond)))
+		} else {
+			logger.Info(status("✓ restarted in %s", elapsed.Round(100*time.Millisecond)))
+		}
+	}
+	c.cycles++
+	c.failed = false
+	c.start = time.Time{}
+	c.rebuilt = false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// envFile reads the variables of a dotenv file. The file is read again in every
+// cycle to apply its changes, keeping the previous variables if it becomes invalid.
+type envFile struct {
+	path string
+
+	mu   sync.Mutex
+	vars []string
+}
+
+// newEnvFile reads the file for the first time and fails if it is missing or invalid.
+func newEnvFile(path string) (*envFile, error) {
+	vars, err := parseEnvFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &envFile{path: path, vars: vars}, nil
+}
+
+// Vars returns the variables of the file as KEY=VALUE. It is empty if the file is
+// not configured.
+func (file *envFile) Vars() []string {
+	if file == nil {
+		return nil
+	}
+
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	vars, err := parseEnvFile(file.path)
+	if err != nil {
+		log.WithField("error", err.Error()).Warning("Cannot reload the env file, keeping the previous variables")
+		return file.vars
+	}
+	file.vars = vars
+	return vars
+}
+
+// parseEnvFile parses the lines KEY=VALUE of a dotenv file. Empty lines and lines
+// starting with # are skipped, and values can be quoted with single or double quotes.
+func parseEnvFile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var vars []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t\"'") {
+			return nil, errors.Errorf("%s:%d: invalid line, it should be KEY=VALUE", path, n)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.Errorf("%s:%d: %v", path, n, err)
+		}
+		vars = append(vars, name+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return vars, nil
+}
+
+// parseEnvValue removes the quotes of the value. Double quoted values accept the
+// escape sequences \n, \" and \\, single quoted ones are literal. Unquoted values
+// end at the first # preceded by a space.
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", errors.Errorf("unterminated single quoted value")
+		}
+		if rest := strings.TrimSpace(value[end+2:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", errors.Errorf("unexpected %q after the quoted value", rest)
+		}
+		return value[1 : end+1], nil
+
+	case '"':
+		var unquoted strings.Builder
+		for i := 1; i < len(value); i++ {
+			switch c := value[i]; c {
+			case '\\':
+				if i+1 == len(value) {
+					return "", errors.Errorf("unterminated double quoted value")
+				}
+				i++
+				switch value[i] {
+				case 'n':
+					unquoted.WriteByte('\n')
+				default:
+					unquoted.WriteByte(value[i])
+				}
+			case '"':
+				if rest := strings.TrimSpace(value[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+					return "", errors.Errorf("unexpected %q after the quoted value", rest)
+				}
+				return unquoted.String(), nil
+			default:
+				unquoted.WriteByte(c)
+			}
+		}
+		return "", errors.Errorf("unterminated double quoted value")
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
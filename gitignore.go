@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// gitignore matches the folders ignored by the .gitignore files of the repository.
+// The nested files apply relative to their own folder. Every file is read once the
+// first time a folder inside it is checked.
+type gitignore struct {
+	root string
+
+	mu    sync.Mutex
+	rules map[string][]gitignoreRule
+}
+
+type gitignoreRule struct {
+	pattern string
+	negate  bool
+
+	// The pattern has a slash and matches the whole path relative to the folder of
+	// the file instead of only the name.
+	anchored bool
+}
+
+func newGitignore(root string) *gitignore {
+	return &gitignore{
+		root:  root,
+		rules: make(map[string][]gitignoreRule),
+	}
+}
+
+// Ignored reports if the folder matches the .gitignore files of the folders above it.
+// It is a no-op if the gitignore files are not used.
+func (g *gitignore) Ignored(folder string) bool {
+	if g == nil {
+		return false
+	}
+	abs, err := filepath.Abs(folder)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(g.root, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	// The last rule that matches wins, the nested files go after their parents.
+	var ignored bool
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		dir := filepath.Join(append([]string{g.root}, parts[:i]...)...)
+		sub := strings.Join(parts[i:], "/")
+		for _, rule := range g.load(dir) {
+			if rule.match(sub) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (g *gitignore) load(dir string) []gitignoreRule {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	rules, ok := g.rules[dir]
+	if ok {
+		return rules
+	}
+	content, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithFields(log.Fields{
+				"path":  dir,
+				"error": err.Error(),
+			}).Warning("Cannot read the .gitignore file, its folders will be watched")
+		}
+	} else {
+		rules = parseGitignore(string(content))
+	}
+	g.rules[dir] = rules
+	return rules
+}
+
+func parseGitignore(content string) []gitignoreRule {
+	var rules []gitignoreRule
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule gitignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+
+		// Only folders are checked, the patterns of folders match the same.
+		line = strings.TrimSuffix(line, "/")
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// match reports if the rule matches the path relative to the folder of its file.
+// The patterns without slashes match the name of any nested folder.
+func (rule gitignoreRule) match(rel string) bool {
+	if rule.anchored {
+		return matchGlob(rule.pattern, rel)
+	}
+	ok, _ := path.Match(rule.pattern, path.Base(rel))
+	return ok
+}
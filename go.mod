@@ -5,10 +5,15 @@ go 1.20
 require (
 	github.com/altipla-consulting/cmdbase v0.2.6
 	github.com/altipla-consulting/errors v1.2.5
+	github.com/mattn/go-shellwords v1.0.15
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/cobra v1.7.0
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/exp v0.0.0-20230522175609-2e198f4a06a1
 	golang.org/x/sync v0.2.0
+	golang.org/x/sys v0.8.0
+	golang.org/x/term v0.8.0
+	gopkg.in/yaml.v3 v3.0.1
 	libs.altipla.consulting v1.185.0
 )
 
@@ -17,6 +22,4 @@ require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/kyokomi/emoji/v2 v2.2.12 // indirect
 	github.com/natefinch/lumberjack v2.0.0+incompatible // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.8.0 // indirect
 )
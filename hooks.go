@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// runHook runs a user command through the shell streaming its output to the terminal.
+// Failures of the command itself are logged and reported as errHookFailed so the
+// caller can decide if they should stop the cycle.
+func runHook(ctx context.Context, name, command string) error {
+	return runHookWith(ctx, name, command, os.Stdin, nil)
+}
+
+// runHookWith runs a hook like runHook but sends the input to the command instead
+// of the standard input of reloader. If env is nil it inherits the environment.
+func runHookWith(ctx context.Context, name, command string, input io.Reader, env []string) error {
+	if command == "" {
+		return nil
+	}
+
+	logger := log.WithField("command", command)
+	logger.Info(status("%s...", name))
+
+	cmd := shellCommand(ctx, command)
+	cmd.Env = env
+	cmd.Stdin = input
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if _, ok := err.(*exec.ExitError); ok {
+			logger.WithField("error", err.Error()).Error(status("%s failed!", name))
+			return errors.Trace(errHookFailed)
+		}
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+var errHookFailed = errors.New("reloader: hook failed")
+
+// notifyBuild runs the hooks configured after a build. The output of the build is
+// sent to the standard input of the command when it fails.
+func notifyBuild(ctx context.Context, opts runOptions, err error) {
+	var berr *buildError
+	switch {
+	case err == nil:
+		err = runHook(ctx, "on build success", opts.onBuildSuccess)
+	case errors.As(err, &berr):
+		err = runHookWith(ctx, "on build fail", opts.onBuildFail, bytes.NewReader(berr.output), nil)
+	default:
+		return
+	}
+	if err != nil && !errors.Is(err, errHookFailed) {
+		log.WithField("error", err.Error()).Error("Cannot run the build hook")
+	}
+}
+
+// runPreRestart runs the hook before stopping the process to restart it. It returns
+// false if the hook failed and the restart should be cancelled.
+func runPreRestart(ctx context.Context, opts runOptions) (bool, error) {
+	if err := runHook(ctx, "pre restart", opts.preRestart); err != nil {
+		if errors.Is(err, errHookFailed) {
+			if opts.preRestartStrict {
+				log.Warning(status("restart cancelled"))
+				return false, nil
+			}
+			return true, nil
+		}
+		return false, errors.Trace(err)
+	}
+	return true, nil
+}
+
+// waitReady blocks until the app is ready to accept requests. It returns false if the
+// process stops before that. Without --wait-port or --health-url the app is ready as
+// soon as it starts.
+func waitReady(ctx context.Context, opts runOptions) bool {
+	if opts.waitPort > 0 && !waitPort(ctx, opts.waitPort, opts.waitPortTimeout) {
+		return false
+	}
+	if opts.healthURL != "" && !waitHealth(ctx, opts.healthURL, opts.healthTimeout) {
+		return false
+	}
+	return ctx.Err() == nil
+}
+
+// notifyReady waits in the background for the app to be ready, reports it and runs
+// the on-ready hook. The returned function should be called when the process stops.
+func notifyReady(ctx context.Context, opts runOptions) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		if !waitReady(ctx, opts) {
+			return
+		}
+		opts.cycles.Status(logEvent("ready", nil), "ready")
+		opts.appStatus.ProcessReady()
+		opts.proxy.AppReady()
+
+		if err := runHook(ctx, "on ready", opts.onReady); err != nil && !errors.Is(err, errHookFailed) {
+			log.WithField("error", err.Error()).Error("Cannot run the on ready hook")
+		}
+	}()
+	return cancel
+}
+
+// changeHook is a command of --on-change that runs when the files of an extension
+// change, without rebuilding nor restarting the app.
+type changeHook struct {
+	ext     string
+	command string
+}
+
+// parseChangeHook parses a value like ".sql:go run ./cmd/migrate".
+func parseChangeHook(value string) (changeHook, error) {
+	ext, command, ok := strings.Cut(value, ":")
+	if !ok || !strings.HasPrefix(ext, ".") || strings.TrimSpace(command) == "" {
+		return changeHook{}, errors.Errorf("it should be EXT:COMMAND, like '.sql:go run ./cmd/migrate'")
+	}
+	return changeHook{ext: ext, command: command}, nil
+}
+
+// matchChangeHooks returns the commands of the hooks for the extension of the file.
+func matchChangeHooks(hooks []changeHook, file string) []string {
+	var commands []string
+	for _, hook := range hooks {
+		if filepath.Ext(file) == hook.ext {
+			commands = append(commands, hook.command)
+		}
+	}
+	return commands
+}
+
+// runChangeHook runs a command of --on-change. Failures are logged but ignored.
+func runChangeHook(ctx context.Context, command string, opts runOptions) {
+	err := runHookWith(ctx, "on change", command, nil, buildEnv(opts))
+	if err != nil && !errors.Is(err, errHookFailed) {
+		log.WithFields(log.Fields{
+			"command": command,
+			"error":   err.Error(),
+		}).Error(status("on change failed!"))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/altipla-consulting/errors"
+)
+
+type resourceLimits struct {
+	// Number of CPUs, it can be fractional.
+	cpu float64
+
+	// Memory in bytes.
+	memory int64
+}
+
+func (limits resourceLimits) enabled() bool {
+	return limits.cpu > 0 || limits.memory > 0
+}
+
+// parseMemory parses sizes like 512M or 2G.
+func parseMemory(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	number := value
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		number = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.Errorf("invalid memory size %q, use bytes or a K, M or G suffix", value)
+	}
+	return n * multiplier, nil
+}
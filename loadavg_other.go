@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// systemLoad is not available in this platform.
+func systemLoad() (float64, bool) {
+	return 0, false
+}
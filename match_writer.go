@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxMatchLine is the longest line checked against the expression. Longer lines,
+// like output without newlines, are skipped instead of buffering them forever.
+const maxMatchLine = 64 * 1024
+
+// matchWriter passes the output through and asks for a restart when a line matches
+// the expression.
+type matchWriter struct {
+	out     io.Writer
+	re      *regexp.Regexp
+	restart chan empty
+	line    []byte
+
+	// The rest of the current line is skipped because it is too long.
+	skip bool
+}
+
+func newMatchWriter(out io.Writer, re *regexp.Regexp, restart chan empty) *matchWriter {
+	return &matchWriter{out: out, re: re, restart: restart}
+}
+
+func (w *matchWriter) Write(p []byte) (int, error) {
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+		if !w.skip && w.re.Match(bytes.TrimRight(w.line[:i], "\r")) {
+			log.WithField("line", string(w.line[:i])).Info(status("restart requested by the app"))
+			send(w.restart)
+		}
+		w.line = w.line[i+1:]
+		w.skip = false
+	}
+	if len(w.line) > maxMatchLine {
+		w.line = w.line[:0]
+		w.skip = true
+	}
+	return w.out.Write(p)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// prefixWriter adds a prefix at the start of every line of the output, to know
+// which app printed it when several of them run at the same time.
+type prefixWriter struct {
+	out     io.Writer
+	prefix  []byte
+	midline bool
+}
+
+// newPrefixWriter returns out directly if the prefix is empty.
+func newPrefixWriter(out io.Writer, prefix string) io.Writer {
+	if prefix == "" {
+		return out
+	}
+	return &prefixWriter{out: out, prefix: []byte(prefix)}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	var buf []byte
+	for rest := p; len(rest) > 0; {
+		if !w.midline {
+			buf = append(buf, w.prefix...)
+		}
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf = append(buf, rest...)
+			w.midline = true
+			break
+		}
+		buf = append(buf, rest[:i+1]...)
+		rest = rest[i+1:]
+		w.midline = false
+	}
+	if _, err := w.out.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
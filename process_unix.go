@@ -0,0 +1,88 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/altipla-consulting/errors"
+)
+
+// configureProcess runs the child in its own process group so the processes it
+// spawns can be stopped together, unless it should stay in the foreground group to
+// read from the terminal. A new session also creates a new group and detaches the
+// child from the terminal, so the signals of the shell job control do not reach it.
+//
+// When reloader exits the process receives the final stop signal and it is killed
+// if it does not finish in time.
+func configureProcess(cmd *exec.Cmd, opts runOptions) {
+	switch {
+	case opts.newSession:
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	case !opts.foreground:
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	cmd.Cancel = func() error {
+		return signalProcess(cmd, opts.finalStopSignal)
+	}
+	cmd.WaitDelay = opts.stopTimeout
+}
+
+// trackProcess does nothing, the process group of configureProcess already contains
+// the children of the process.
+func trackProcess(cmd *exec.Cmd) {}
+
+// releaseProcess does nothing, see trackProcess.
+func releaseProcess(cmd *exec.Cmd) {}
+
+func signalProcess(cmd *exec.Cmd, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return cmd.Process.Signal(sig)
+	}
+	// Processes we started have their own group. Attached ones are signaled directly.
+	pid := cmd.Process.Pid
+	if cmd.SysProcAttr != nil && (cmd.SysProcAttr.Setpgid || cmd.SysProcAttr.Setsid) {
+		pid = -pid
+	}
+	if err := syscall.Kill(pid, s); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return signalProcess(cmd, syscall.SIGKILL)
+}
+
+// shellCommand runs the command through the shell of the user.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return exec.CommandContext(ctx, shell, "-c", command)
+}
+
+func processAlive(proc *os.Process) bool {
+	return proc.Signal(syscall.Signal(0)) == nil
+}
+
+// waitAttached waits until a process that is not our child exits.
+func waitAttached(ctx context.Context, proc *os.Process) error {
+	for processAlive(proc) {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync"
+	"unsafe"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows"
+)
+
+func configureProcess(cmd *exec.Cmd, opts runOptions) {}
+
+// jobs are the job objects of the running processes by PID. Windows has no process
+// groups, the job contains the children of the process too.
+var (
+	jobsMu sync.Mutex
+	jobs   = make(map[int]windows.Handle)
+)
+
+// trackProcess assigns the started process to a new job object, so its children
+// can be killed together. Errors are logged and only the process is stopped then.
+func trackProcess(cmd *exec.Cmd) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		log.WithField("error", err.Error()).Warning("Cannot create a job object for the app, its children will not be stopped")
+		return
+	}
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		log.WithField("error", err.Error()).Warning("Cannot configure the job object of the app, its children will not be stopped")
+		windows.CloseHandle(job)
+		return
+	}
+	proc, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		log.WithField("error", err.Error()).Warning("Cannot open the app to assign its job object, its children will not be stopped")
+		windows.CloseHandle(job)
+		return
+	}
+	defer windows.CloseHandle(proc)
+	if err := windows.AssignProcessToJobObject(job, proc); err != nil {
+		log.WithField("error", err.Error()).Warning("Cannot assign the job object of the app, its children will not be stopped")
+		windows.CloseHandle(job)
+		return
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	jobs[cmd.Process.Pid] = job
+}
+
+// releaseProcess closes the job object of the process after it exits, killing the
+// children that are still running.
+func releaseProcess(cmd *exec.Cmd) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if job, ok := jobs[cmd.Process.Pid]; ok {
+		windows.CloseHandle(job)
+		delete(jobs, cmd.Process.Pid)
+	}
+}
+
+// signalProcess can only kill the process in Windows, other signals are sent to
+// the process alone and usually fail.
+func signalProcess(cmd *exec.Cmd, sig os.Signal) error {
+	if sig == os.Kill {
+		return killProcess(cmd)
+	}
+	return cmd.Process.Signal(sig)
+}
+
+// killProcess terminates the whole job object of the process, or the process alone
+// if it does not have one.
+func killProcess(cmd *exec.Cmd) error {
+	jobsMu.Lock()
+	job, ok := jobs[cmd.Process.Pid]
+	jobsMu.Unlock()
+	if !ok {
+		return cmd.Process.Kill()
+	}
+	return errors.Trace(windows.TerminateJobObject(job, 1))
+}
+
+// shellCommand runs the command through the Windows command interpreter.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
+
+// processAlive is always true because finding the process already fails
+// if it does not exist in Windows.
+func processAlive(proc *os.Process) bool {
+	return true
+}
+
+// waitAttached waits until a process that is not our child exits.
+func waitAttached(ctx context.Context, proc *os.Process) error {
+	_, err := proc.Wait()
+	return errors.Trace(err)
+}
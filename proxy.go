@@ -0,0 +1,163 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const devProxyWaitPath = "/__reloader/wait"
+
+// devProxy forwards requests to the app and replaces its pages with the
+// compiler output while the build is broken.
+type devProxy struct {
+	proxy *httputil.ReverseProxy
+
+	mu       sync.Mutex
+	buildErr []byte
+	changed  chan empty
+}
+
+func newDevProxy(target string) (*devProxy, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, errors.Errorf("invalid --proxy-target: %v", err)
+	}
+	p := &devProxy{
+		proxy:   httputil.NewSingleHostReverseProxy(u),
+		changed: make(chan empty),
+	}
+	p.proxy.ErrorHandler = p.serveWaiting
+	return p, nil
+}
+
+// BuildFailed shows the output of the build in the browser until the next
+// successful build. It is a no-op if the proxy is disabled.
+func (p *devProxy) BuildFailed(output []byte) {
+	if p == nil {
+		return
+	}
+	p.setBuildErr(output)
+}
+
+// BuildSucceeded clears the build error. Pages showing it are reloaded later when
+// the new process is ready. It is a no-op if the proxy is disabled.
+func (p *devProxy) BuildSucceeded() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buildErr = nil
+}
+
+// AppReady reloads the pages waiting for the app. It is a no-op if the proxy
+// is disabled.
+func (p *devProxy) AppReady() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.notifyChanged()
+}
+
+func (p *devProxy) setBuildErr(output []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buildErr = output
+	p.notifyChanged()
+}
+
+// notifyChanged wakes up the pages waiting for changes. The lock should be held.
+func (p *devProxy) notifyChanged() {
+	close(p.changed)
+	p.changed = make(chan empty)
+}
+
+func (p *devProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	buildErr := p.buildErr
+	changed := p.changed
+	p.mu.Unlock()
+
+	if r.URL.Path == devProxyWaitPath {
+		select {
+		case <-r.Context().Done():
+		case <-changed:
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if buildErr != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := tmplBuildFailed.Execute(w, string(buildErr)); err != nil {
+			log.WithField("error", err.Error()).Error("Cannot render the build error page")
+		}
+		return
+	}
+
+	p.proxy.ServeHTTP(w, r)
+}
+
+// serveWaiting is used while the app is restarting and cannot accept connections yet.
+func (p *devProxy) serveWaiting(w http.ResponseWriter, r *http.Request, err error) {
+	log.WithField("error", err.Error()).Debug("Proxy cannot reach the app")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusBadGateway)
+	if err := tmplWaiting.Execute(w, nil); err != nil {
+		log.WithField("error", err.Error()).Error("Cannot render the waiting page")
+	}
+}
+
+var tmplBuildFailed = template.Must(template.New("build-failed").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Build failed</title>
+	<style>
+		body { margin: 0; background: #1e1e1e; color: #eee; font-family: sans-serif; }
+		h1 { margin: 0; padding: 16px 24px; background: #c62828; font-size: 18px; }
+		pre { margin: 0; padding: 24px; font-size: 14px; white-space: pre-wrap; }
+	</style>
+</head>
+<body>
+	<h1>Build failed</h1>
+	<pre>{{.}}</pre>
+	<script>
+		function wait() {
+			fetch('` + devProxyWaitPath + `').then(() => location.reload(), () => setTimeout(wait, 1000));
+		}
+		wait();
+	</script>
+</body>
+</html>
+`))
+
+var tmplWaiting = template.Must(template.New("waiting").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Waiting for the app</title>
+</head>
+<body>
+	<p>Waiting for the app to start...</p>
+	<script>
+		// Reload when the app is ready, or retry in case the page missed it.
+		fetch('` + devProxyWaitPath + `').then(() => location.reload());
+		setTimeout(() => location.reload(), 2000);
+	</script>
+</body>
+</html>
+`))
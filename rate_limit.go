@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// outputLimiter caps the number of lines per second of the output of the app,
+// shared between all its streams.
+type outputLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	start   time.Time
+	count   int
+	dropped int
+
+	// Reports the dropped lines when the second ends, even if no more lines arrive.
+	timer *time.Timer
+}
+
+// newOutputLimiter returns nil if the limit is disabled.
+func newOutputLimiter(limit int) *outputLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &outputLimiter{limit: limit}
+}
+
+// Writer limits the lines written to out. It returns out directly if the limiter
+// is disabled.
+func (limiter *outputLimiter) Writer(out io.Writer) io.Writer {
+	if limiter == nil {
+		return out
+	}
+	return &limitedWriter{limiter: limiter, out: out}
+}
+
+// allow reports if a new line can be written in the current second.
+func (limiter *outputLimiter) allow() bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if time.Since(limiter.start) >= time.Second {
+		limiter.flushLocked()
+		limiter.start = time.Now()
+		limiter.count = 0
+	}
+	if limiter.count < limiter.limit {
+		limiter.count++
+		return true
+	}
+	limiter.dropped++
+	if limiter.dropped == 1 {
+		limiter.timer = time.AfterFunc(time.Until(limiter.start.Add(time.Second)), limiter.Flush)
+	}
+	return false
+}
+
+// Flush reports the lines dropped since the last report. It is a no-op if the
+// limiter is disabled.
+func (limiter *outputLimiter) Flush() {
+	if limiter == nil {
+		return
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.flushLocked()
+}
+
+func (limiter *outputLimiter) flushLocked() {
+	if limiter.timer != nil {
+		limiter.timer.Stop()
+		limiter.timer = nil
+	}
+	if limiter.dropped > 0 {
+		log.Warning(status("… %d lines suppressed", limiter.dropped))
+		limiter.dropped = 0
+	}
+}
+
+type limitedWriter struct {
+	limiter *outputLimiter
+	out     io.Writer
+
+	// The last write did not finish the line, its remaining chunks follow the same
+	// decision of the start of the line.
+	midLine bool
+	allowed bool
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	for rest := p; len(rest) > 0; {
+		chunk := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			chunk = rest[:i+1]
+		}
+		rest = rest[len(chunk):]
+
+		if !w.midLine {
+			w.allowed = w.limiter.allow()
+		}
+		w.midLine = chunk[len(chunk)-1] != '\n'
+		if w.allowed {
+			if _, err := w.out.Write(chunk); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
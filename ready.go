@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// waitPort polls the port of the app until it accepts connections. It returns false
+// if the context is cancelled or the timeout elapses before that.
+func waitPort(ctx context.Context, port int, timeout time.Duration) bool {
+	addr := fmt.Sprintf("localhost:%d", port)
+	deadline := time.After(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			log.WithFields(log.Fields{
+				"port":    port,
+				"timeout": timeout.String(),
+			}).Warning(status("the app is not listening in the port yet, it will not be reported as ready"))
+			return false
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// waitHealth requests the URL periodically until it returns a 2xx status. It returns
+// false if the context is cancelled or the timeout elapses before that.
+func waitHealth(ctx context.Context, url string, timeout time.Duration) bool {
+	client := &http.Client{Timeout: 2 * time.Second}
+	deadline := time.After(timeout)
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return false
+		}
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return true
+			}
+			log.WithFields(log.Fields{
+				"url":    url,
+				"status": resp.Status,
+			}).Debug("Healthcheck failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			log.WithFields(log.Fields{
+				"url":     url,
+				"timeout": timeout.String(),
+			}).Warning(status("the healthcheck of the app is not passing yet, it will not be reported as ready"))
+			return false
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// serveHTTP runs the server until the context is cancelled.
+func serveHTTP(ctx context.Context, name, addr string, handler http.Handler) func() error {
+	return func() error {
+		server := &http.Server{
+			Addr:    addr,
+			Handler: handler,
+		}
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+
+		log.WithField("addr", addr).Infof("%s listening", name)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return errors.Trace(err)
+		}
+		return nil
+	}
+}
+
+// controlHandler serves the endpoints to query reloader from other tools.
+func controlHandler(status *appStatus) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status.Snapshot()); err != nil {
+			log.WithField("error", err.Error()).Error("Cannot send the status")
+		}
+	})
+	return mux
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/altipla-consulting/errors"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// parseSignal accepts signal names like SIGHUP or HUP in any case.
+func parseSignal(name string) (os.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := signalNames[name]
+	if !ok {
+		names := maps.Keys(signalNames)
+		slices.Sort(names)
+		return nil, errors.Errorf("unknown signal %q, use one of %s", name, strings.Join(names, ", "))
+	}
+	return sig, nil
+}
+
+// signalName returns the name of the signal as accepted by parseSignal.
+func signalName(sig os.Signal) string {
+	for name, s := range signalNames {
+		if s == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
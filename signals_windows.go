@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+)
+
+var signalNames = map[string]os.Signal{
+	"SIGINT":  os.Interrupt,
+	"SIGKILL": os.Kill,
+}
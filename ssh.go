@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/altipla-consulting/errors"
+)
+
+// remoteHost runs commands in another machine through ssh. The sources should be
+// in the same folder of the remote machine, with a shared mount or synced by a hook.
+type remoteHost struct {
+	host string
+	dir  string
+
+	// File of the remote machine where the long lived process writes its PID.
+	pidFile string
+}
+
+func newRemoteHost(host, dir string) *remoteHost {
+	return &remoteHost{
+		host:    host,
+		dir:     dir,
+		pidFile: fmt.Sprintf("/tmp/reloader-%d.pid", os.Getpid()),
+	}
+}
+
+// Command runs the command in the remote folder. The words are quoted for the
+// remote shell.
+func (remote *remoteHost) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "ssh", "-q", remote.host, remote.script(shellJoin(append([]string{name}, args...))))
+}
+
+// Process runs a long lived shell script in the remote folder. A terminal is
+// allocated so the remote process receives a hangup when the connection is closed.
+// The PID is saved before replacing the shell to signal the process later.
+func (remote *remoteHost) Process(ctx context.Context, script string) *exec.Cmd {
+	script = fmt.Sprintf("echo $$ > %s && exec %s", shellQuote(remote.pidFile), script)
+	return exec.CommandContext(ctx, "ssh", "-tt", "-q", remote.host, remote.script(script))
+}
+
+// signalTimeout is the time to wait for the ssh command that sends a signal.
+const signalTimeout = 15 * time.Second
+
+// Signal sends the signal to the long lived process of the remote machine. It does
+// not use the context of the app because it is called when it is cancelled too.
+func (remote *remoteHost) Signal(sig os.Signal) error {
+	ctx, cancel := context.WithTimeout(context.Background(), signalTimeout)
+	defer cancel()
+
+	script := fmt.Sprintf("kill -s %s $(cat %s)", strings.TrimPrefix(signalName(sig), "SIG"), shellQuote(remote.pidFile))
+	cmd := exec.CommandContext(ctx, "ssh", "-q", remote.host, script)
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return os.ErrProcessDone
+		}
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+func (remote *remoteHost) script(script string) string {
+	return fmt.Sprintf("cd %s && %s", shellQuote(remote.dir), script)
+}
+
+func shellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = shellQuote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// startOrder tracks if an app is restarting, so the next app can wait for it to
+// start before starting itself when they restart at the same time.
+type startOrder struct {
+	mu      sync.Mutex
+	pending bool
+	started chan empty
+}
+
+// newStartOrder creates the order of an app that did not start yet.
+func newStartOrder() *startOrder {
+	return &startOrder{pending: true, started: make(chan empty)}
+}
+
+// Begin marks the app as restarting. It is a no-op if the starts are not ordered.
+func (o *startOrder) Begin() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.pending {
+		o.pending = true
+		o.started = make(chan empty)
+	}
+}
+
+// Done marks the app as started, or waiting for changes if it could not start.
+// It is a no-op if the starts are not ordered.
+func (o *startOrder) Done() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.pending {
+		o.pending = false
+		close(o.started)
+	}
+}
+
+// waitStagger waits for the previous app to start if it is restarting too, and
+// then the --stagger delay. It returns false if the context is cancelled.
+func waitStagger(ctx context.Context, prev *startOrder, stagger time.Duration) bool {
+	if prev == nil {
+		return true
+	}
+	prev.mu.Lock()
+	pending, started := prev.pending, prev.started
+	prev.mu.Unlock()
+	if !pending {
+		return true
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-started:
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(stagger):
+		return true
+	}
+}
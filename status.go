@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	stateBuilding = "building"
+	stateRunning  = "running"
+	stateFailed   = "failed"
+	stateStopped  = "stopped"
+)
+
+// appStatus keeps the counters of the app lifecycle shared by the reporting features.
+type appStatus struct {
+	mu                sync.Mutex
+	state             string
+	lastBuildDuration time.Duration
+	lastError         string
+	processStart      time.Time
+	lastExitCode      int
+	restarts          int
+	ready             bool
+	watchedDirs       int
+}
+
+func newAppStatus() *appStatus {
+	return &appStatus{state: stateStopped}
+}
+
+type statusSnapshot struct {
+	State               string  `json:"state"`
+	LastBuildDurationMs int64   `json:"last_build_duration_ms"`
+	LastError           string  `json:"last_error"`
+	UptimeSeconds       float64 `json:"uptime_seconds"`
+	LastExitCode        int     `json:"last_exit_code"`
+	Restarts            int     `json:"restarts"`
+	Ready               bool    `json:"ready"`
+	WatchedDirs         int     `json:"watched_dirs"`
+}
+
+func (s *appStatus) BuildStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = stateBuilding
+}
+
+func (s *appStatus) BuildFinished(duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastBuildDuration = duration
+	if err != nil {
+		s.state = stateFailed
+		s.lastError = err.Error()
+	} else {
+		s.state = stateStopped
+	}
+}
+
+func (s *appStatus) ProcessStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.processStart.IsZero() {
+		s.restarts++
+	}
+	s.state = stateRunning
+	s.processStart = time.Now()
+	s.ready = false
+}
+
+// ProcessReady marks the running process as ready to accept requests.
+func (s *appStatus) ProcessReady() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = true
+}
+
+// ProcessExited marks the process as stopped with its exit code, which is -1 if it
+// is unknown.
+func (s *appStatus) ProcessExited(err error, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = false
+	s.lastExitCode = code
+	if err != nil {
+		s.state = stateFailed
+		s.lastError = err.Error()
+	} else {
+		s.state = stateStopped
+	}
+}
+
+// AddWatchedDirs counts the folders being watched, n is negative when they stop.
+// It is a no-op if there is no status.
+func (s *appStatus) AddWatchedDirs(n int) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchedDirs += n
+}
+
+func (s *appStatus) Snapshot() statusSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := statusSnapshot{
+		State:               s.state,
+		LastBuildDurationMs: s.lastBuildDuration.Milliseconds(),
+		LastError:           s.lastError,
+		LastExitCode:        s.lastExitCode,
+		Restarts:            s.restarts,
+		Ready:               s.ready,
+		WatchedDirs:         s.watchedDirs,
+	}
+	if s.state == stateRunning {
+		snapshot.UptimeSeconds = time.Since(s.processStart).Seconds()
+	}
+	return snapshot
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/altipla-consulting/errors"
+)
+
+// testRunResult is a line of the --results-jsonl file.
+type testRunResult struct {
+	Time        time.Time    `json:"time"`
+	Passed      bool         `json:"passed"`
+	FailedTests []failedTest `json:"failed_tests"`
+	DurationMs  int64        `json:"duration_ms"`
+}
+
+type failedTest struct {
+	Package string `json:"package"`
+	Test    string `json:"test"`
+}
+
+// testEvent is the output of go test -json.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+// testEventWriter parses the output of go test -json printing the text output of
+// the tests and keeping the ones that failed. Like go test, if it is not verbose
+// the output of each test is only printed when it fails. In raw mode the events
+// are printed unchanged for external formatters.
+type testEventWriter struct {
+	out     io.Writer
+	verbose bool
+	raw     bool
+	pending []byte
+	failed  []failedTest
+	outputs map[failedTest][]byte
+}
+
+func (w *testEventWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.pending[:i+1]
+		w.pending = w.pending[i+1:]
+		if err := w.handle(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *testEventWriter) handle(line []byte) error {
+	if w.raw {
+		if _, err := w.out.Write(line); err != nil {
+			return err
+		}
+	}
+
+	var event testEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		if w.raw {
+			return nil
+		}
+
+		// Not an event, for example the build errors of old Go versions.
+		_, err := w.out.Write(line)
+		return err
+	}
+	test := failedTest{Package: event.Package, Test: event.Test}
+	if w.raw {
+		if event.Action == "fail" && event.Test != "" {
+			w.failed = append(w.failed, test)
+		}
+		return nil
+	}
+	switch event.Action {
+	case "output", "build-output":
+		// Non verbose runs of go test only print the summary of the packages that pass.
+		if event.Test == "" && !w.verbose && event.Output == "PASS\n" {
+			return nil
+		}
+		if event.Test == "" || w.verbose {
+			_, err := io.WriteString(w.out, event.Output)
+			return err
+		}
+		if !strings.HasPrefix(event.Output, "=== ") {
+			if w.outputs == nil {
+				w.outputs = make(map[failedTest][]byte)
+			}
+			w.outputs[test] = append(w.outputs[test], event.Output...)
+		}
+	case "fail":
+		if event.Test != "" {
+			w.failed = append(w.failed, test)
+			if _, err := w.out.Write(w.outputs[test]); err != nil {
+				return err
+			}
+			delete(w.outputs, test)
+		}
+	case "pass", "skip":
+		delete(w.outputs, test)
+	}
+	return nil
+}
+
+// appendTestResult adds the result of the run to the end of the file.
+func appendTestResult(path string, result testRunResult) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(result); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
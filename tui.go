@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// tuiLines is the height of the status bar at the bottom of the terminal.
+const tuiLines = 2
+
+// runStatusBar keeps a status bar with the state of the app at the bottom of the
+// terminal. It is not interactive, the output of the build and the app scrolls
+// above it with the scrollback of the terminal. It does nothing if the standard
+// output is not a terminal.
+func runStatusBar(ctx context.Context, status *appStatus) func() error {
+	return func() error {
+		fd := int(os.Stdout.Fd())
+		if !term.IsTerminal(fd) {
+			log.Debug("Standard output is not a terminal, status bar disabled")
+			return nil
+		}
+
+		var height int
+		defer func() {
+			if height > 0 {
+				// Restore the scrolling of the whole terminal and clear the status bar.
+				fmt.Fprintf(os.Stdout, "\x1b7\x1b[r\x1b[%d;1H\x1b[J\x1b8", height-tuiLines+1)
+			}
+		}()
+
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			width, h, err := term.GetSize(fd)
+			if err == nil && h > tuiLines {
+				if h != height {
+					// Leave the last lines out of the scrolling region and move the cursor
+					// inside it.
+					height = h
+					fmt.Fprintf(os.Stdout, "\n\n\x1b[1;%dr\x1b[%d;1H", height-tuiLines, height-tuiLines)
+				}
+				renderStatusBar(width, height, status.Snapshot())
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+func renderStatusBar(width, height int, snapshot statusSnapshot) {
+	state := fmt.Sprintf(" reloader | %s | restarts: %d | watched folders: %d", snapshot.State, snapshot.Restarts, snapshot.WatchedDirs)
+	if snapshot.State == stateRunning {
+		state += fmt.Sprintf(" | uptime: %s", (time.Duration(snapshot.UptimeSeconds) * time.Second).String())
+	}
+	if snapshot.LastBuildDurationMs > 0 {
+		state += fmt.Sprintf(" | last build: %dms", snapshot.LastBuildDurationMs)
+	}
+	lastError := " last error: -"
+	if snapshot.LastError != "" {
+		lastError = " last error: " + strings.ReplaceAll(snapshot.LastError, "\n", " ")
+	}
+
+	// Save the cursor, draw the lines in reverse video and restore the cursor.
+	var sb strings.Builder
+	sb.WriteString("\x1b7")
+	for i, line := range []string{state, lastError} {
+		if len(line) > width {
+			line = line[:width]
+		}
+		fmt.Fprintf(&sb, "\x1b[%d;1H\x1b[2K\x1b[7m%-*s\x1b[0m", height-tuiLines+1+i, width, line)
+	}
+	sb.WriteString("\x1b8")
+	fmt.Fprint(os.Stdout, sb.String())
+}
+
+// clearScreen clears the terminal and moves the cursor to the top. It does nothing
+// if the standard output is not a terminal, to keep the escape codes out of the logs.
+func clearScreen() {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprint(os.Stdout, "\x1b[H\x1b[2J")
+	}
+}
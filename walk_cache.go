@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// walkCacheEntry is the set of watched folders of a tree saved in disk, with the
+// modification times of the top level folders when it was walked.
+type walkCacheEntry struct {
+	TopLevel map[string]int64 `json:"topLevel"`
+	Paths    []string         `json:"paths"`
+}
+
+// cachedWalkFolders returns the folders of the tree to watch like walkFolders, but
+// reuses the result of a previous walk if the top level folders did not change.
+// Folders created deeper in the tree are not detected until one of them changes.
+func cachedWalkFolders(opts watchOptions, folder string) ([]string, error) {
+	logger := log.WithField("path", folder)
+
+	file, err := walkCacheFile(opts, folder)
+	if err != nil {
+		logger.WithField("error", err.Error()).Debug("Cannot use the walk cache")
+		return walkFolders(opts, folder, nil)
+	}
+
+	topLevel, err := topLevelTimes(folder)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var entry walkCacheEntry
+	if content, err := os.ReadFile(file); err == nil {
+		if err := json.Unmarshal(content, &entry); err == nil && sameTimes(entry.TopLevel, topLevel) && allExist(entry.Paths) {
+			logger.WithField("dirs", len(entry.Paths)).Debug("Watched folders restored from the walk cache")
+			return entry.Paths, nil
+		}
+	}
+
+	paths, err := walkFolders(opts, folder, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	content, err := json.Marshal(walkCacheEntry{TopLevel: topLevel, Paths: paths})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		logger.WithField("error", err.Error()).Debug("Cannot save the walk cache")
+		return paths, nil
+	}
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		logger.WithField("error", err.Error()).Debug("Cannot save the walk cache")
+	}
+	return paths, nil
+}
+
+// walkCacheFile returns the path of the cache of the tree. The key includes the
+// working directory and the options that change the result of the walk.
+func walkCacheFile(opts watchOptions, folder string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	key, err := json.Marshal([]any{wd, folder, opts.ignore, opts.include, opts.maxDirs, opts.gitignore != nil, opts.followSymlinks})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	sum := sha256.Sum256(key)
+	return filepath.Join(dir, "reloader", "walk-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// topLevelTimes returns the modification times of the folder and its direct
+// children folders. They change when a child folder is created, removed or renamed.
+func topLevelTimes(folder string) (map[string]int64, error) {
+	times := make(map[string]int64)
+	info, err := os.Stat(folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return times, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	times[folder] = info.ModTime().UnixNano()
+
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Trace(err)
+		}
+		path := filepath.Join(folder, entry.Name())
+		times[path] = info.ModTime().UnixNano()
+	}
+	return times, nil
+}
+
+func sameTimes(a, b map[string]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, t := range a {
+		if other, ok := b[path]; !ok || other != t {
+			return false
+		}
+	}
+	return true
+}
+
+// allExist reports if the restored folders still exist. Removing a folder deeper in
+// the tree does not change the times of the top level ones.
+func allExist(paths []string) bool {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
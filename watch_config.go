@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+	"libs.altipla.consulting/watch"
+)
+
+// scopeConfig are the folders to watch that can be changed while running.
+type scopeConfig struct {
+	Watch  []string `yaml:"watch"`
+	Ignore []string `yaml:"ignore"`
+}
+
+func loadScopeConfig(path string) (scopeConfig, error) {
+	var cfg scopeConfig
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, errors.Trace(err)
+	}
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return cfg, errors.Errorf("cannot parse %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// watchScope watches the folders like watchFolder, adding the ones in the config
+// file to the flags. When the file changes the folders are walked again with the new
+// rules without restarting reloader.
+func watchScope(ctx context.Context, changes chan string, opts watchOptions, folders []string, config string) func() error {
+	return func() error {
+		config, err := filepath.Abs(config)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		cfg, err := loadScopeConfig(config)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		// Editors replace the file when saving it, watch the folder instead.
+		configChanges := make(chan string)
+		grp, ctx := errgroup.WithContext(ctx)
+		grp.Go(func() error {
+			return errors.Trace(watch.Files(ctx, configChanges, filepath.Dir(config)))
+		})
+
+		grp.Go(func() error {
+			for {
+				scopeCtx, cancel := context.WithCancel(ctx)
+				scope, scopeCtx := errgroup.WithContext(scopeCtx)
+				scopeOpts := opts
+				scopeOpts.ignore = append(slices.Clone(opts.ignore), cfg.Ignore...)
+				for _, folder := range append(slices.Clone(folders), cfg.Watch...) {
+					scope.Go(watchFolder(scopeCtx, changes, scopeOpts, folder))
+				}
+				scopeErr := make(chan error, 1)
+				go func() {
+					scopeErr <- scope.Wait()
+				}()
+
+			wait:
+				for {
+					select {
+					case <-ctx.Done():
+						cancel()
+						<-scopeErr
+						return nil
+
+					case err := <-scopeErr:
+						cancel()
+						return errors.Trace(err)
+
+					case change := <-configChanges:
+						if abs, err := filepath.Abs(change); err != nil || abs != config {
+							continue
+						}
+						next, err := loadScopeConfig(config)
+						if err != nil {
+							log.WithField("error", err.Error()).Warning("Cannot reload the watch config, keeping the previous folders")
+							continue
+						}
+						if slices.Equal(next.Watch, cfg.Watch) && slices.Equal(next.Ignore, cfg.Ignore) {
+							continue
+						}
+						cfg = next
+						break wait
+					}
+				}
+
+				cancel()
+				if err := <-scopeErr; err != nil && !errors.Is(err, context.Canceled) {
+					return errors.Trace(err)
+				}
+				log.WithFields(log.Fields{
+					"watch":  cfg.Watch,
+					"ignore": cfg.Ignore,
+				}).Info(status("watch config changed, watching the new folders"))
+			}
+		})
+
+		return errors.Trace(grp.Wait())
+	}
+}
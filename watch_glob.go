@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
+	"libs.altipla.consulting/watch"
+)
+
+// isGlob reports if the folder to watch is a pattern of files instead.
+func isGlob(folder string) bool {
+	return strings.ContainsAny(folder, "*?[")
+}
+
+// watchGlob watches the folders of the files that match the pattern and discards
+// the changes of the rest of files inside them. A ** element matches any number
+// of nested folders.
+func watchGlob(ctx context.Context, changes chan string, opts watchOptions, pattern string) func() error {
+	return func() error {
+		pattern = filepath.Clean(pattern)
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return errors.Errorf("invalid --watch %q: %v", pattern, err)
+		}
+
+		root := pattern
+		for isGlob(root) {
+			root = filepath.Dir(root)
+		}
+		var paths []string
+		walkFn := func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return errors.Trace(err)
+			}
+			if info.IsDir() {
+				if ignoredFolder(opts, path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if dir := filepath.Dir(path); matchGlob(pattern, path) && !slices.Contains(paths, dir) {
+				paths = append(paths, dir)
+			}
+			return nil
+		}
+		if err := filepath.Walk(root, walkFn); err != nil {
+			return errors.Trace(err)
+		}
+		if len(paths) == 0 {
+			log.WithField("pattern", pattern).Warning("No files match the watch pattern, nothing will be watched for it")
+			return nil
+		}
+
+		opts.appStatus.AddWatchedDirs(len(paths))
+		defer opts.appStatus.AddWatchedDirs(-len(paths))
+
+		grp, ctx := errgroup.WithContext(ctx)
+		all := make(chan string)
+		grp.Go(func() error {
+			log.WithField("pattern", pattern).Debug("Watching changes")
+			return errors.Trace(watch.Files(ctx, all, paths...))
+		})
+		grp.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case change := <-all:
+					if !matchGlob(pattern, filepath.Clean(change)) {
+						continue
+					}
+					select {
+					case <-ctx.Done():
+						return nil
+					case changes <- change:
+					}
+				}
+			}
+		})
+		return errors.Trace(grp.Wait())
+	}
+}
+
+// matchGlob reports if the file matches the pattern, where ** matches zero or more
+// folders.
+func matchGlob(pattern, file string) bool {
+	return matchSegments(strings.Split(filepath.ToSlash(pattern), "/"), strings.Split(filepath.ToSlash(file), "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
+	"libs.altipla.consulting/watch"
+)
+
+const (
+	// watcherNative walks the tree when starting and watches every folder with the
+	// notifications of the system. New folders are walked and watched when created.
+	watcherNative = "native"
+
+	// watcherRecursive lets the watch library follow the tree, including the folders
+	// created later. Ignored folders are filtered after receiving their changes.
+	watcherRecursive = "recursive"
+
+	// watcherPoll walks the tree periodically comparing the files. It is slower but
+	// works in network and container mounts without notifications.
+	watcherPoll = "poll"
+)
+
+const defaultPollInterval = time.Second
+
+const watcherUsage = "Implementation of the watcher: native watches the folders found when starting and the new ones, recursive lets the watch library follow the tree and poll compares the files every --poll-interval for mounts without notifications."
+
+const pollIntervalUsage = "Time between the walks of the poll watcher. Longer intervals use less CPU in huge trees but detect the changes later."
+
+var watchers = []string{watcherNative, watcherRecursive, watcherPoll}
+
+func checkWatcher(watcher string, pollInterval time.Duration) error {
+	if !slices.Contains(watchers, watcher) {
+		return errors.Errorf("invalid --watcher %q: it should be one of %v", watcher, watchers)
+	}
+	if pollInterval <= 0 {
+		return errors.Errorf("invalid --poll-interval %s: it should be greater than zero", pollInterval)
+	}
+	return nil
+}
+
+// watchRecursive watches the whole tree with the recursive implementation of the
+// library, discarding the changes of the ignored folders.
+func watchRecursive(ctx context.Context, changes chan string, opts watchOptions, folder string) func() error {
+	return func() error {
+		grp, ctx := errgroup.WithContext(ctx)
+		all := make(chan string)
+		grp.Go(func() error {
+			log.WithField("path", folder).Debug("Watching changes recursively")
+			return errors.Trace(watch.Recursive(ctx, all, folder))
+		})
+		grp.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case change := <-all:
+					if ignoredChange(opts, change) {
+						continue
+					}
+					select {
+					case <-ctx.Done():
+						return nil
+					case changes <- change:
+					}
+				}
+			}
+		})
+		return errors.Trace(grp.Wait())
+	}
+}
+
+// ignoredChange reports if the change is inside an ignored folder or outside the
+// included ones.
+func ignoredChange(opts watchOptions, change string) bool {
+	dir := filepath.Dir(change)
+	if len(opts.include) > 0 && !matchesInclude(opts.include, dir) {
+		return true
+	}
+	for ; ; dir = filepath.Dir(dir) {
+		if ignoredFolder(opts, dir) {
+			return true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// pollFolder walks the tree every poll interval and sends the files that were created,
+// modified or removed since the previous walk.
+func pollFolder(ctx context.Context, changes chan string, opts watchOptions, folder string) func() error {
+	return func() error {
+		prev := make(map[string]fileState)
+		paths, err := walkFolders(opts, folder, prev)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		opts.appStatus.AddWatchedDirs(len(paths))
+		defer func() { opts.appStatus.AddWatchedDirs(-len(paths)) }()
+
+		log.WithField("path", folder).Debug("Polling changes")
+		ticker := time.NewTicker(opts.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			next := make(map[string]fileState)
+			nextPaths, err := walkFolders(opts, folder, next)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			opts.appStatus.AddWatchedDirs(len(nextPaths) - len(paths))
+			paths = nextPaths
+
+			var modified []string
+			for path, state := range next {
+				if old, ok := prev[path]; !ok || old != state {
+					modified = append(modified, path)
+				}
+			}
+			for path := range prev {
+				if _, ok := next[path]; !ok {
+					modified = append(modified, path)
+				}
+			}
+			prev = next
+
+			for _, path := range modified {
+				select {
+				case <-ctx.Done():
+					return nil
+				case changes <- path:
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// webhook posts the lifecycle events of the app to a URL. The requests are sent in
+// the background and their errors are only logged.
+type webhook struct {
+	url string
+	pkg string
+}
+
+type webhookEvent struct {
+	Event     string    `json:"event"`
+	Package   string    `json:"package"`
+	Timestamp time.Time `json:"timestamp"`
+	Success   bool      `json:"success"`
+}
+
+func newWebhook(url, pkg string) *webhook {
+	return &webhook{url: url, pkg: pkg}
+}
+
+// Send posts the event. It is a no-op if the webhook is not configured.
+func (hook *webhook) Send(event string, success bool) {
+	if hook == nil {
+		return
+	}
+
+	body, err := json.Marshal(webhookEvent{
+		Event:     event,
+		Package:   hook.pkg,
+		Timestamp: time.Now(),
+		Success:   success,
+	})
+	if err != nil {
+		log.WithField("error", err.Error()).Warning("Cannot encode the webhook event")
+		return
+	}
+
+	go func() {
+		logger := log.WithFields(log.Fields{
+			"url":   hook.url,
+			"event": event,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.url, bytes.NewReader(body))
+		if err != nil {
+			logger.WithField("error", err.Error()).Warning("Cannot send the webhook event")
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			logger.WithField("error", err.Error()).Warning("Cannot send the webhook event")
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logger.WithField("status", resp.Status).Warning("The webhook rejected the event")
+		}
+	}()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/altipla-consulting/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// workspaceModules returns the folders of the modules used by the go.work file,
+// if there is one. The workspace build includes them, so their changes should
+// rebuild the app too.
+func workspaceModules(ctx context.Context) ([]string, error) {
+	env := exec.CommandContext(ctx, "go", "env", "GOWORK")
+	env.Stderr = os.Stderr
+	output, err := env.Output()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	gowork := strings.TrimSpace(string(output))
+	if gowork == "" || gowork == "off" {
+		return nil, nil
+	}
+
+	edit := exec.CommandContext(ctx, "go", "work", "edit", "-json", gowork)
+	edit.Stderr = os.Stderr
+	output, err = edit.Output()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var work struct {
+		Use []struct {
+			DiskPath string
+		}
+	}
+	if err := json.Unmarshal(output, &work); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var dirs []string
+	for _, use := range work.Use {
+		dir := use.DiskPath
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(gowork), dir)
+		}
+		dirs = append(dirs, dir)
+	}
+	log.WithField("modules", dirs).Debug("Workspace detected")
+
+	return dirs, nil
+}
+
+// unwatchedModules returns the modules of the workspace that are not watched yet.
+// A module that contains one of the folders, or is inside one of them, would
+// report the same files twice with different paths.
+func unwatchedModules(folders, modules []string) ([]string, error) {
+	var unwatched []string
+	for _, module := range modules {
+		module = filepath.Clean(module)
+		var watched bool
+		for _, folder := range folders {
+			abs, err := filepath.Abs(folder)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if insideFolder(abs, module) || insideFolder(module, abs) {
+				watched = true
+				break
+			}
+		}
+		if !watched {
+			unwatched = append(unwatched, module)
+		}
+	}
+	return unwatched, nil
+}
+
+// insideFolder reports if the path is the folder or one of its descendants.
+func insideFolder(path, folder string) bool {
+	return path == folder || strings.HasPrefix(path, folder+string(filepath.Separator))
+}
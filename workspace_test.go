@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
+)
+
+// writeWorkspace creates a workspace with the app and lib modules and selects it
+// with GOWORK. It returns the root folder of the workspace.
+func writeWorkspace(t *testing.T) string {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.work":     "go 1.20\n\nuse (\n\t./app\n\t./lib\n)\n",
+		"app/go.mod":  "module example.com/app\n\ngo 1.20\n",
+		"app/main.go": "package main\n\nimport \"example.com/lib\"\n\nfunc main() { lib.Hello() }\n",
+		"lib/go.mod":  "module example.com/lib\n\ngo 1.20\n",
+		"lib/lib.go":  "package lib\n\nfunc Hello() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOWORK", filepath.Join(root, "go.work"))
+	return root
+}
+
+func TestWorkspaceModules(t *testing.T) {
+	root := writeWorkspace(t)
+
+	dirs, err := workspaceModules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "app"), filepath.Join(root, "lib")}
+	if !slices.Equal(dirs, want) {
+		t.Errorf("workspaceModules() = %v, want %v", dirs, want)
+	}
+}
+
+func TestWorkspaceModulesOff(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+
+	dirs, err := workspaceModules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) > 0 {
+		t.Errorf("workspaceModules() = %v, want no modules", dirs)
+	}
+}
+
+func TestUnwatchedModules(t *testing.T) {
+	root := writeWorkspace(t)
+	app := filepath.Join(root, "app")
+	lib := filepath.Join(root, "lib")
+
+	tests := []struct {
+		folders []string
+		want    []string
+	}{
+		{[]string{app}, []string{lib}},
+		{[]string{filepath.Join(app, "cmd")}, []string{lib}},
+		{[]string{root}, nil},
+		{[]string{app, lib}, nil},
+	}
+	for _, test := range tests {
+		got, err := unwatchedModules(test.folders, []string{app, lib})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("unwatchedModules(%v) = %v, want %v", test.folders, got, test.want)
+		}
+	}
+}
+
+func TestWorkspaceChangeRebuilds(t *testing.T) {
+	root := writeWorkspace(t)
+	app := filepath.Join(root, "app")
+
+	modules, err := workspaceModules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders := []string{app}
+	unwatched, err := unwatchedModules(folders, modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders = append(folders, unwatched...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	grp, ctx := errgroup.WithContext(ctx)
+	defer func() {
+		cancel()
+		if err := grp.Wait(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	changes := make(chan string)
+	wopts := watchOptions{
+		watcher:      watcherPoll,
+		pollInterval: 10 * time.Millisecond,
+	}
+	for _, folder := range folders {
+		grp.Go(watchFolder(ctx, changes, wopts, folder))
+	}
+	trig := newTriggers()
+	grp.Go(receiveWatchChanges(ctx, changes, runOptions{debounce: 10 * time.Millisecond}, trig))
+
+	// Give the pollers time to read the initial state of the files.
+	time.Sleep(50 * time.Millisecond)
+	changed := filepath.Join(root, "lib", "lib.go")
+	if err := os.WriteFile(changed, []byte("package lib\n\nfunc Hello() { println(\"hello\") }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case req := <-trig.rebuild:
+		if !slices.Equal(req.files, []string{changed}) {
+			t.Errorf("rebuild files = %v, want %v", req.files, []string{changed})
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change of the lib module did not rebuild the app")
+	}
+}